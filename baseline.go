@@ -0,0 +1,95 @@
+package libmigrate
+
+import (
+	"context"
+	"fmt"
+)
+
+func (m *migrator) Baseline(ctx context.Context, version int) error {
+	return m.baseline(ctx, version, false)
+}
+
+func (m *migrator) ForceBaseline(ctx context.Context, version int) error {
+	return m.baseline(ctx, version, true)
+}
+
+func (m *migrator) baseline(ctx context.Context, version int, force bool) (err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	err = m.db.RequireSchema(ctx)
+	if err != nil {
+		return
+	}
+
+	// The version table may not match the filesystem yet, so only the files
+	// are checked.
+	names, err := m.filesystem.ListMigrationDir()
+	if err != nil {
+		return
+	}
+	migrationsByVersion, err := parseMigrationFilenames(names, m.goMigrations)
+	if err != nil {
+		return
+	}
+	if version < 1 || version > len(migrationsByVersion) {
+		return &badVersionError{
+			version: version,
+			problem: fmt.Sprintf("baseline version must be between 1 and %d", len(migrationsByVersion)),
+		}
+	}
+
+	dbMigrations, err := m.db.ListMigrations(ctx)
+	if err != nil {
+		return
+	}
+	if len(dbMigrations) > 0 && !force {
+		return &baselineNotEmptyError{applied: len(dbMigrations)}
+	}
+
+	applied := make([]dbMigration, version)
+	for i := range applied {
+		migration := migrationsByVersion[i+1]
+		applied[i] = dbMigration{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		applied[i].Checksum, err = m.upChecksum(migration)
+		if err != nil {
+			return
+		}
+	}
+
+	err = m.db.MarkMigrations(ctx, applied, dbMigrations)
+	if err != nil {
+		return
+	}
+
+	message := fmt.Sprintf("Baselined at version %d", version)
+	if len(dbMigrations) > 0 {
+		message += fmt.Sprintf(", removing %d recorded migration(s)", len(dbMigrations))
+	}
+	m.log(ctx, LogEvent{
+		Message:   message,
+		Version:   version,
+		Name:      applied[version-1].Name,
+		ToVersion: version,
+	})
+	return nil
+}
+
+// upChecksum returns the checksum recorded when migration is applied.
+func (m *migrator) upChecksum(migration migration) (string, error) {
+	if migration.Go != nil {
+		return "", nil
+	}
+
+	sqlString, err := m.filesystem.ReadMigration(migration.Filename(true))
+	if err != nil {
+		return "", err
+	}
+	return checksum(sqlString), nil
+}
@@ -0,0 +1,57 @@
+package libmigrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseline(t *testing.T) {
+	m, db, fs := Fixture(t)
+	fs.readMigration = func(name string) (string, error) { return "-- " + name, nil }
+	var applied, unapplied []dbMigration
+	db.markMigrations = func(ctx context.Context, a, u []dbMigration) error {
+		applied, unapplied = a, u
+		return nil
+	}
+
+	err := m.Baseline(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, []dbMigration{
+		{Version: 1, Name: "v1", Checksum: checksum("-- 0001_v1.up.sql")},
+		{Version: 2, Name: "v2", Checksum: checksum("-- 0002_v2.up.sql")},
+	}, applied)
+	require.Empty(t, unapplied)
+}
+
+func TestBaselineNotEmpty(t *testing.T) {
+	m, db, _ := Fixture(t)
+	existing := []dbMigration{{Version: 1, Name: "other"}}
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return existing, nil
+	}
+	var applied, unapplied []dbMigration
+	db.markMigrations = func(ctx context.Context, a, u []dbMigration) error {
+		applied, unapplied = a, u
+		return nil
+	}
+
+	err := m.Baseline(context.Background(), 3)
+	require.Equal(t, &baselineNotEmptyError{applied: 1}, err)
+
+	err = m.ForceBaseline(context.Background(), 3)
+	require.NoError(t, err)
+	require.Len(t, applied, 3)
+	require.Equal(t, existing, unapplied)
+}
+
+func TestBaselineBadVersion(t *testing.T) {
+	m, _, _ := Fixture(t)
+
+	err := m.Baseline(context.Background(), 4)
+	require.Equal(t, &badVersionError{
+		version: 4,
+		problem: "baseline version must be between 1 and 3",
+	}, err)
+}
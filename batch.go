@@ -0,0 +1,233 @@
+package libmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// A BatchMode controls whether MigrateTo runs all of its migrations in one
+// transaction, so that a failure rolls the database back to the version it
+// started from.
+type BatchMode int
+
+const (
+	// Each migration runs in its own transaction.
+	BatchNone BatchMode = iota
+	// The migrations run in one transaction if they can: none of them uses
+	// NoTransactionPrefix, and the dialect can roll back DDL. Otherwise each
+	// runs in its own, as with BatchNone.
+	BatchPreferred
+	// The migrations run in one transaction. If they can't, nothing runs.
+	BatchRequired
+)
+
+func (m *migrator) SetBatchMode(mode BatchMode) {
+	m.batchMode = mode
+}
+
+// A batchMigration is one migration of a batch run by ApplyBatch.
+type batchMigration struct {
+	IsUp     bool
+	Version  int
+	Name     string
+	Checksum string
+	// One of these is set
+	Query string
+	Go    GoMigrationFunc
+
+	// Optional. Before returns the context the migration runs with, which
+	// After is also called with. After is called before the transaction
+	// commits.
+	Before func(ctx context.Context) (context.Context, error)
+	After  func(ctx context.Context, duration time.Duration, err error)
+}
+
+// batchProblem returns why steps can't run in one transaction, if they
+// can't.
+func (m *migrator) batchProblem(steps []PlanStep) error {
+	if !m.dialect.TransactionalDDL() {
+		return &batchNotPossibleError{}
+	}
+	for _, step := range steps {
+		if !step.UseTransaction {
+			return &batchNotPossibleError{
+				version: step.Version,
+				name:    step.Name,
+			}
+		}
+	}
+	return nil
+}
+
+// applySteps runs steps planned for path, in one transaction if the batch
+// mode asks for it.
+func (m *migrator) applySteps(ctx context.Context, run *runState, path []migration, steps []PlanStep) (err error) {
+	run.event.Migrations = len(steps)
+	fromVersion, toVersion := run.event.FromVersion, run.event.ToVersion
+	started := run.event
+	err = m.beforeRun(ctx, fromVersion, toVersion)
+	if err != nil {
+		return
+	}
+	start := time.Now()
+	m.notify(ctx, &started)
+	defer func() {
+		m.afterRun(ctx, fromVersion, toVersion, time.Since(start), err)
+	}()
+
+	if m.batchMode != BatchNone && len(steps) > 1 {
+		problem := m.batchProblem(steps)
+		if problem == nil {
+			return m.applyBatch(ctx, path, steps)
+		}
+		if m.batchMode == BatchRequired {
+			return problem
+		}
+		m.log(ctx, LogEvent{
+			Level:   LogWarn,
+			Message: fmt.Sprintf("Running each migration in its own transaction: %v", problem),
+		})
+	}
+
+	for i, step := range steps {
+		err = m.applyStep(ctx, path[i], step)
+		if err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func (m *migrator) applyBatch(ctx context.Context, path []migration, steps []PlanStep) error {
+	m.logf(ctx, "Running %d migrations in one transaction", len(steps))
+
+	// Migrations are only reported as finished once the transaction commits;
+	// until then, any of them can still be rolled back.
+	type result struct {
+		started      bool
+		ctx          context.Context
+		duration     time.Duration
+		err          error
+		endMigration func(error)
+	}
+	results := make([]result, len(steps))
+
+	report := m.logger != nil || len(m.observers) > 0 || m.tracer != nil
+
+	batch := make([]batchMigration, len(steps))
+	for i, step := range steps {
+		batch[i] = batchMigration{
+			IsUp:    step.IsUp,
+			Version: step.Version,
+			Name:    step.Name,
+			Query:   step.SQL,
+		}
+		if path[i].Go != nil {
+			batch[i].Go = path[i].Go.fn(step.IsUp)
+		} else if step.IsUp {
+			batch[i].Checksum = checksum(step.SQL)
+		}
+
+		step := step
+		result := &results[i]
+		if report || m.hooks.BeforeMigration != nil {
+			batch[i].Before = func(ctx context.Context) (context.Context, error) {
+				m.stepStarted(ctx, step, TransactionBatch)
+				ctx, result.endMigration = m.startMigration(ctx, step, TransactionBatch)
+				result.started = true
+				result.ctx = ctx
+				result.err = m.beforeMigration(ctx, step)
+				return ctx, result.err
+			}
+		}
+		if report || m.hooks.AfterMigration != nil {
+			batch[i].After = func(ctx context.Context, duration time.Duration, err error) {
+				result.duration = duration
+				result.err = err
+				m.afterMigration(ctx, step, duration, err)
+			}
+		}
+	}
+
+	err := m.db.ApplyBatch(ctx, batch)
+	for i, step := range steps {
+		result := results[i]
+		if !result.started {
+			continue
+		}
+		stepErr := result.err
+		if stepErr == nil {
+			stepErr = err
+		}
+		m.stepFinished(result.ctx, step, result.duration, stepErr)
+		result.endMigration(stepErr)
+	}
+	if err != nil {
+		m.log(ctx, LogEvent{
+			Level:   LogWarn,
+			Message: fmt.Sprintf("Rolled back all %d migrations", len(steps)),
+			Err:     err,
+		})
+	}
+	return err
+}
+
+// ApplyBatch runs migrations in one transaction, recording each in the
+// version table. If one fails, they're all rolled back, and the error is a
+// *batchMigrationError.
+func (w *dbWrapperImpl) ApplyBatch(ctx context.Context, migrations []batchMigration) (err error) {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	for _, migration := range migrations {
+		migrationCtx := ctx
+		if migration.Before != nil {
+			if migrationCtx, err = migration.Before(ctx); err != nil {
+				return
+			}
+		}
+
+		start := time.Now()
+		err = w.applyBatchMigration(migrationCtx, tx, migration)
+		if migration.After != nil {
+			migration.After(migrationCtx, time.Since(start), err)
+		}
+		if err != nil {
+			return &batchMigrationError{
+				version: migration.Version,
+				name:    migration.Name,
+				isUp:    migration.IsUp,
+				cause:   err,
+			}
+		}
+	}
+	return nil
+}
+
+func (w *dbWrapperImpl) applyBatchMigration(ctx context.Context, tx *sql.Tx, migration batchMigration) (err error) {
+	start := time.Now()
+	if migration.Go != nil {
+		err = migration.Go(ctx, tx)
+	} else {
+		_, err = w.execMigration(ctx, tx, migration.Query)
+	}
+	if err != nil {
+		return
+	}
+
+	if migration.IsUp {
+		return w.recordApplied(ctx, tx, migration.Version, migration.Name, migration.Checksum, start, time.Since(start))
+	}
+	return w.recordUnapplied(ctx, tx, migration.Version, migration.Name)
+}
@@ -0,0 +1,102 @@
+package libmigrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func batchFixture(t *testing.T, mode BatchMode) (*migrator, *dbMock, *fsMock) {
+	m, db, fs := Fixture(t)
+	m.SetBatchMode(mode)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	fs.readMigration = func(name string) (string, error) { return "-- " + name, nil }
+	return m, db, fs
+}
+
+func TestBatchPreferred(t *testing.T) {
+	m, db, _ := batchFixture(t, BatchPreferred)
+	var batch []batchMigration
+	db.applyBatch = func(ctx context.Context, migrations []batchMigration) error {
+		batch = migrations
+		return nil
+	}
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, []batchMigration{
+		{IsUp: true, Version: 1, Name: "v1", Checksum: checksum("-- 0001_v1.up.sql"), Query: "-- 0001_v1.up.sql"},
+		{IsUp: true, Version: 2, Name: "v2", Checksum: checksum("-- 0002_v2.up.sql"), Query: "-- 0002_v2.up.sql"},
+	}, batch)
+}
+
+func TestBatchPreferredFallsBack(t *testing.T) {
+	m, db, fs := batchFixture(t, BatchPreferred)
+	fs.readMigration = func(name string) (string, error) {
+		if name == "0002_v2.up.sql" {
+			return NoTransactionPrefix, nil
+		}
+		return "", nil
+	}
+	var applied []int
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		applied = append(applied, version)
+		return nil
+	}
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, applied)
+}
+
+func TestBatchRequired(t *testing.T) {
+	m, db, fs := batchFixture(t, BatchRequired)
+	fs.readMigration = func(name string) (string, error) {
+		if name == "0002_v2.up.sql" {
+			return NoTransactionPrefix, nil
+		}
+		return "", nil
+	}
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		t.Fatal("applied a migration outside the batch")
+		return nil
+	}
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.Equal(t, &batchNotPossibleError{version: 2, name: "v2"}, err)
+
+	m.dialect = MySQLDialect{}
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		return nil
+	}
+	err = m.MigrateTo(context.Background(), 1)
+	require.NoError(t, err, "a single migration doesn't need a batch")
+}
+
+func TestApplyBatchRollsBack(t *testing.T) {
+	f, db := newFakeDB(t)
+	cause := errors.New("syntax error")
+	f.onError(`^CREATE TABLE c`, cause)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   PostgresDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.ApplyBatch(context.Background(), []batchMigration{
+		{IsUp: true, Version: 1, Name: "b", Query: "CREATE TABLE b (id int);"},
+		{IsUp: true, Version: 2, Name: "c", Query: "CREATE TABLE c (id int);"},
+	})
+	require.IsType(t, &batchMigrationError{}, err)
+	require.Equal(t, 2, err.(*batchMigrationError).Version())
+	require.Equal(t, cause, err.(*batchMigrationError).Cause().(*migrateError).Cause())
+	require.Equal(t, []string{
+		"BEGIN",
+		"CREATE TABLE b (id int);",
+		`INSERT INTO "migration_version" (version, name, checksum, applied_at, duration_ms, applied_by, libmigrate_version) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		"CREATE TABLE c (id int);",
+		"ROLLBACK",
+	}, f.queries)
+}
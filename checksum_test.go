@@ -0,0 +1,109 @@
+package libmigrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum(t *testing.T) {
+	require.Equal(t,
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		checksum(""))
+	require.NotEqual(t, checksum("SELECT 1;"), checksum("SELECT 2;"))
+}
+
+func checksumFixture(t *testing.T, stored string) *migrator {
+	m, db, fs := Fixture(t)
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{
+			{Version: 1, Name: "v1", Checksum: stored},
+		}, nil
+	}
+	fs.readMigration = func(name string) (string, error) {
+		require.Equal(t, "0001_v1.up.sql", name)
+		return "CREATE TABLE edited ();", nil
+	}
+	return m
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	m := checksumFixture(t, checksum("CREATE TABLE original ();"))
+
+	_, err := m.listMigrations(context.Background())
+	require.Equal(t, &ChecksumMismatchError{
+		version:         1,
+		name:            "v1",
+		storedChecksum:  checksum("CREATE TABLE original ();"),
+		currentChecksum: checksum("CREATE TABLE edited ();"),
+	}, err)
+}
+
+func TestChecksumMatch(t *testing.T) {
+	m := checksumFixture(t, checksum("CREATE TABLE edited ();"))
+
+	_, err := m.listMigrations(context.Background())
+	require.NoError(t, err)
+}
+
+func TestChecksumMissingIsSkipped(t *testing.T) {
+	m := checksumFixture(t, "")
+
+	_, err := m.listMigrations(context.Background())
+	require.NoError(t, err)
+}
+
+func TestChecksumVerificationDisabled(t *testing.T) {
+	m := checksumFixture(t, checksum("CREATE TABLE original ();"))
+	m.SetVerifyChecksums(false)
+
+	_, err := m.listMigrations(context.Background())
+	require.NoError(t, err)
+}
+
+func TestApplyRecordsChecksum(t *testing.T) {
+	m, db, fs := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) {
+		return 0, nil
+	}
+	fs.readMigration = func(name string) (string, error) {
+		return "-- " + name, nil
+	}
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, sum string) error {
+		require.Equal(t, checksum(query), sum)
+		return nil
+	}
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.NoError(t, err)
+}
+
+func TestRepairChecksums(t *testing.T) {
+	m, db, fs := Fixture(t)
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{
+			{Version: 1, Name: "v1", Checksum: checksum("unchanged")},
+			{Version: 2, Name: "v2", Checksum: checksum("original")},
+			{Version: 3, Name: "v3"},
+		}, nil
+	}
+	fs.readMigration = func(name string) (string, error) {
+		if name == "0001_v1.up.sql" {
+			return "unchanged", nil
+		}
+		return "edited", nil
+	}
+	updated := make(map[int]string)
+	db.setChecksum = func(ctx context.Context, version int, sum string) error {
+		updated[version] = sum
+		return nil
+	}
+
+	err := m.RepairChecksums(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[int]string{
+		2: checksum("edited"),
+		3: checksum("edited"),
+	}, updated)
+}
@@ -0,0 +1,183 @@
+package libmigrate
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// A Dialect describes the SQL syntax and capabilities of a database.
+//
+// PostgresDialect, SQLiteDialect, MySQLDialect and SQLServerDialect are
+// built in. ParamType values are also Dialects, for compatibility with older
+// versions of libmigrate; they use ANSI quoting and no lock.
+type Dialect interface {
+	// Placeholder returns the bind parameter for the n'th argument of a
+	// query, counting from 1.
+	Placeholder(n int) string
+	// QuoteIdentifier quotes a table name.
+	QuoteIdentifier(name string) string
+	// CreateTableSQL returns a statement creating a table with the given
+	// column definitions, which does nothing if the table already exists.
+	// It's used to create the version table. The table name is already
+	// quoted.
+	CreateTableSQL(table string, columns []string) string
+	// TransactionalDDL reports whether schema changes can be rolled back as
+	// part of a transaction.
+	TransactionalDDL() bool
+	// Locker returns the default lock for the version table schema."table"
+	// (unquoted), or nil to run without one.
+	Locker(schema, table string) Locker
+}
+
+// PostgresDialect supports PostgreSQL, locking with an advisory lock.
+type PostgresDialect struct{}
+
+func (PostgresDialect) Placeholder(n int) string           { return fmt.Sprintf("$%d", n) }
+func (PostgresDialect) QuoteIdentifier(name string) string { return ansiQuoteIdentifier(name) }
+func (PostgresDialect) TransactionalDDL() bool             { return true }
+
+func (PostgresDialect) CreateTableSQL(table string, columns []string) string {
+	return createTableIfNotExistsSQL(table, columns)
+}
+
+func (PostgresDialect) Locker(schema, table string) Locker {
+	return NewPostgresLocker(lockKey(schema, table))
+}
+
+// SQLiteDialect supports SQLite. It has no lock by default: SQLite allows one
+// writer at a time anyway, and a lock row left by a crashed process would
+// block every later run. To lock across processes, use SetLocker with
+// NewTableLocker.
+type SQLiteDialect struct{}
+
+func (SQLiteDialect) Placeholder(n int) string           { return "?" }
+func (SQLiteDialect) QuoteIdentifier(name string) string { return ansiQuoteIdentifier(name) }
+func (SQLiteDialect) TransactionalDDL() bool             { return true }
+
+func (SQLiteDialect) CreateTableSQL(table string, columns []string) string {
+	return createTableIfNotExistsSQL(table, columns)
+}
+
+func (SQLiteDialect) Locker(schema, table string) Locker { return nil }
+
+// MySQLDialect supports MySQL and MariaDB, locking with GET_LOCK.
+type MySQLDialect struct{}
+
+func (MySQLDialect) Placeholder(n int) string { return "?" }
+func (MySQLDialect) TransactionalDDL() bool   { return false }
+
+func (MySQLDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (MySQLDialect) CreateTableSQL(table string, columns []string) string {
+	return createTableIfNotExistsSQL(table, columns)
+}
+
+func (MySQLDialect) Locker(schema, table string) Locker {
+	// Lock names are limited to 64 characters
+	return NewMySQLLocker(fmt.Sprintf("libmigrate_%016x", lockKey(schema, table)))
+}
+
+// SQLServerDialect supports Microsoft SQL Server, locking with
+// sp_getapplock. Migrations are split into batches at "GO" lines, like
+// sqlcmd does.
+type SQLServerDialect struct{}
+
+func (SQLServerDialect) Placeholder(n int) string { return fmt.Sprintf("@p%d", n) }
+func (SQLServerDialect) TransactionalDDL() bool   { return true }
+
+func (SQLServerDialect) QuoteIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+func (SQLServerDialect) CreateTableSQL(table string, columns []string) string {
+	return fmt.Sprintf(`
+	IF OBJECT_ID(N'%s', N'U') IS NULL
+	CREATE TABLE %s (
+		%s
+	);`, strings.ReplaceAll(table, "'", "''"), table, strings.Join(columns, ",\n\t\t"))
+}
+
+// SQL Server's text type is deprecated, and can't be compared with =.
+func (SQLServerDialect) textType(short bool) string {
+	if short {
+		return "nvarchar(255)"
+	}
+	return "nvarchar(max)"
+}
+
+func (SQLServerDialect) Locker(schema, table string) Locker {
+	return NewSQLServerLocker(fmt.Sprintf("libmigrate_%016x", lockKey(schema, table)))
+}
+
+func (t ParamType) Placeholder(n int) string {
+	if t == ParamTypeDollarSign {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+func (ParamType) QuoteIdentifier(name string) string { return fmt.Sprintf("\"%s\"", name) }
+func (ParamType) TransactionalDDL() bool             { return true }
+func (ParamType) Locker(schema, table string) Locker { return nil }
+
+func (ParamType) CreateTableSQL(table string, columns []string) string {
+	return createTableIfNotExistsSQL(table, columns)
+}
+
+// Dialects that implement this use their own types for the version table's
+// text columns, instead of "text".
+type textTyper interface {
+	// textType returns the type of a text column. Short columns, like
+	// migration names, are compared with =.
+	textType(short bool) string
+}
+
+func textType(d Dialect, short bool) string {
+	if t, ok := d.(textTyper); ok {
+		return t.textType(short)
+	}
+	return "text"
+}
+
+func ansiQuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func createTableIfNotExistsSQL(table string, columns []string) string {
+	return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		%s
+	);`, table, strings.Join(columns, ",\n\t\t"))
+}
+
+// lockKey identifies a version table across processes.
+func lockKey(schema, table string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(schema + "." + table))
+	return int64(h.Sum64())
+}
+
+// dialectParams returns a paramFunc for queries against d.
+func dialectParams(d Dialect) (paramFunc, error) {
+	// Unknown ParamTypes have always been an error
+	if t, ok := d.(ParamType); ok {
+		return t.getFunc()
+	}
+
+	var i = 0
+	return func() string {
+		i++
+		return d.Placeholder(i)
+	}, nil
+}
+
+func quoteTableName(d Dialect, schema, table string) string {
+	if schema != "" {
+		return fmt.Sprintf("%s.%s", schema, d.QuoteIdentifier(table))
+	}
+
+	return d.QuoteIdentifier(table)
+}
@@ -0,0 +1,114 @@
+package libmigrate
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialectPlaceholders(t *testing.T) {
+	cases := []struct {
+		dialect  Dialect
+		expected []string
+	}{
+		{PostgresDialect{}, []string{"$1", "$2", "$3"}},
+		{SQLiteDialect{}, []string{"?", "?", "?"}},
+		{MySQLDialect{}, []string{"?", "?", "?"}},
+		{SQLServerDialect{}, []string{"@p1", "@p2", "@p3"}},
+		{ParamTypeDollarSign, []string{"$1", "$2", "$3"}},
+		{ParamTypeQuestionMark, []string{"?", "?", "?"}},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%T", c.dialect), func(t *testing.T) {
+			fn, err := dialectParams(c.dialect)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, []string{fn(), fn(), fn()})
+		})
+	}
+}
+
+func TestDialectParamsUnknownParamType(t *testing.T) {
+	_, err := dialectParams(ParamType(9999))
+	require.Equal(t, &unknownParamTypeError{
+		paramType: ParamType(9999),
+	}, err)
+}
+
+func TestDialectQuoteTableName(t *testing.T) {
+	cases := []struct {
+		dialect       Dialect
+		schema, table string
+		expected      string
+	}{
+		{PostgresDialect{}, "", "t", `"t"`},
+		{PostgresDialect{}, "public", `odd"name`, `public."odd""name"`},
+		{SQLiteDialect{}, "", "t", `"t"`},
+		{MySQLDialect{}, "", "t", "`t`"},
+		{MySQLDialect{}, "db", "odd`name", "db.`odd``name`"},
+		{SQLServerDialect{}, "dbo", "odd]name", "dbo.[odd]]name]"},
+		{ParamTypeQuestionMark, "public", "t", `public."t"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expected, func(t *testing.T) {
+			require.Equal(t, c.expected, quoteTableName(c.dialect, c.schema, c.table))
+		})
+	}
+}
+
+func TestDialectLockers(t *testing.T) {
+	require.IsType(t, &sessionLocker{}, PostgresDialect{}.Locker("", "migration_version"))
+	require.IsType(t, &sessionLocker{}, MySQLDialect{}.Locker("", "migration_version"))
+	require.IsType(t, &sessionLocker{}, SQLServerDialect{}.Locker("", "migration_version"))
+	require.Nil(t, SQLiteDialect{}.Locker("s", "migration_version"))
+	require.Equal(t, &tableLocker{
+		tableName: `s."migration_version_lock"`,
+	}, NewTableLocker("s", "migration_version_lock"))
+	require.Nil(t, ParamTypeDollarSign.Locker("", "migration_version"))
+
+	require.NotEqual(t, lockKey("", "a"), lockKey("", "b"))
+	require.NotEqual(t, lockKey("a", "t"), lockKey("b", "t"))
+}
+
+func TestDialectLockerOverride(t *testing.T) {
+	w := &dbWrapperImpl{dialect: PostgresDialect{}, tableName: "migration_version"}
+	w.SetLocker(nil)
+
+	unlock, acquired, err := w.TryLock(context.Background())
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.NoError(t, unlock(context.Background()))
+}
+
+func TestSQLServerCreateTable(t *testing.T) {
+	require.Equal(t, `
+	IF OBJECT_ID(N'dbo.[it''s]', N'U') IS NULL
+	CREATE TABLE dbo.[it's] (
+		id integer NOT NULL,
+		name text
+	);`, SQLServerDialect{}.CreateTableSQL("dbo.[it's]", []string{"id integer NOT NULL", "name text"}))
+}
+
+func TestSQLServerApplyMigration(t *testing.T) {
+	f, db := newFakeDB(t)
+	w := &dbWrapperImpl{
+		db:          db,
+		dialect:     SQLServerDialect{},
+		tableSchema: "dbo",
+		tableName:   "migration_version",
+	}
+
+	err := w.ApplyMigration(context.Background(), true, true, 1, "first",
+		"CREATE TABLE a (id int)\nGO\nCREATE VIEW v AS SELECT id FROM a\n", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"BEGIN",
+		"CREATE TABLE a (id int)",
+		"CREATE VIEW v AS SELECT id FROM a",
+		"INSERT INTO dbo.[migration_version] (version, name, checksum, applied_at, duration_ms, applied_by, libmigrate_version) VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7)",
+		"COMMIT",
+	}, f.queries)
+}
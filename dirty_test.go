@@ -0,0 +1,119 @@
+package libmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func dirtyFixture(t *testing.T) (*migrator, *dbMock) {
+	m, db, _ := Fixture(t)
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{
+			{Version: 1, Name: "v1"},
+			{Version: 2, Name: "v2", Dirty: dirtyUp},
+		}, nil
+	}
+	return m, db
+}
+
+func TestMigrateRefusesWhenDirty(t *testing.T) {
+	m, db := dirtyFixture(t)
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		t.Fatal("migration ran while dirty")
+		return nil
+	}
+
+	err := m.MigrateTo(context.Background(), 3)
+	require.Equal(t, &DirtyError{version: 2, name: "v2", isUp: true}, err)
+}
+
+func TestResolve(t *testing.T) {
+	for _, applied := range []bool{true, false} {
+		m, db := dirtyFixture(t)
+		var resolved []interface{}
+		db.resolveDirty = func(ctx context.Context, version int, applied bool) error {
+			resolved = append(resolved, version, applied)
+			return nil
+		}
+
+		err := m.Resolve(context.Background(), applied)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{2, applied}, resolved)
+	}
+}
+
+func TestResolveNotDirty(t *testing.T) {
+	m, _, _ := Fixture(t)
+
+	err := m.Resolve(context.Background(), true)
+	require.Equal(t, &notDirtyError{}, err)
+}
+
+func TestApplyMigrationWithoutTxMarksDirty(t *testing.T) {
+	f, db := newFakeDB(t)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   SQLiteDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.ApplyMigration(context.Background(), false, true, 1, "first",
+		"CREATE TABLE b (id int);", "abc")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`INSERT INTO "migration_version" (version, name, checksum, applied_by, libmigrate_version, dirty) VALUES (?, ?, ?, ?, ?, ?)`,
+		"CREATE TABLE b (id int);",
+		`UPDATE "migration_version" SET dirty = NULL, applied_at = ?, duration_ms = ? WHERE version = ?`,
+	}, f.queries)
+}
+
+func TestApplyMigrationWithoutTxStaysDirty(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.onError(`^INSERT INTO b`, errors.New("syntax error"))
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   SQLiteDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.ApplyMigration(context.Background(), false, true, 1, "first",
+		"CREATE TABLE b (id int);\nINSERT INTO b VALUES (1);", "abc")
+	require.IsType(t, &partialMigrationError{}, err)
+	require.Empty(t, f.matching(`^DELETE|^UPDATE`))
+}
+
+func TestApplyMigrationWithoutTxCleanFailure(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.onError(`^CREATE TABLE b`, errors.New("syntax error"))
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   SQLiteDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.ApplyMigration(context.Background(), false, true, 1, "first",
+		"CREATE TABLE b (id int);", "abc")
+	require.IsType(t, &migrateError{}, err)
+	require.Equal(t, []string{
+		`DELETE FROM "migration_version" WHERE version = ? AND name = ?`,
+	}, f.matching(`^DELETE`))
+}
+
+func TestGetVersionSkipsDirty(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.onRows(`^SELECT coalesce\(max\(version\), 0\) FROM "migration_version" WHERE dirty IS NULL$`,
+		[]string{"version"}, []driver.Value{int64(2)})
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   SQLiteDialect{},
+		tableName: "migration_version",
+	}
+
+	version, err := w.GetVersion(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+}
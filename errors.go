@@ -1,6 +1,16 @@
 package libmigrate
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// Errors from a Migrator that timed out waiting for the migration lock
+	// match this with errors.Is.
+	ErrLockTimeout = fmt.Errorf("Timed out waiting for migration lock")
+)
 
 type filesystemMissingDbMigrationError struct {
 	version int
@@ -107,14 +117,36 @@ func (e *badMigrationPathError) IsNotDir() bool { return e.isNotDir }
 
 type migrateError struct {
 	cause error
+
+	// Set if the migration was run one statement at a time
+	statement int // Counting from 1
+	total     int
+	startLine int
+	endLine   int
 }
 
 func (e *migrateError) Error() string {
-	return fmt.Sprintf("running migration: %+v", e.cause)
+	if e.statement == 0 {
+		return fmt.Sprintf("running migration: %+v", e.cause)
+	}
+
+	lines := fmt.Sprintf("line %d", e.startLine)
+	if e.endLine != e.startLine {
+		lines = fmt.Sprintf("lines %d-%d", e.startLine, e.endLine)
+	}
+	return fmt.Sprintf("running migration: statement %d of %d (%s): %+v",
+		e.statement, e.total, lines, e.cause)
 }
 
 func (e *migrateError) Cause() error { return e.cause }
 
+// Statement returns which statement failed, counting from 1, or 0 if the
+// migration was run as a whole.
+func (e *migrateError) Statement() int { return e.statement }
+
+// Lines returns the lines of the migration file the failed statement spans.
+func (e *migrateError) Lines() (start, end int) { return e.startLine, e.endLine }
+
 type unknownParamTypeError struct {
 	paramType ParamType
 }
@@ -124,3 +156,284 @@ func (e *unknownParamTypeError) Error() string {
 }
 
 func (e *unknownParamTypeError) ParamType() ParamType { return e.paramType }
+
+type lockTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *lockTimeoutError) Error() string {
+	return fmt.Sprintf("Could not acquire migration lock within %v", e.timeout)
+}
+
+func (e *lockTimeoutError) Is(target error) bool { return target == ErrLockTimeout }
+
+func (e *lockTimeoutError) Timeout() time.Duration { return e.timeout }
+
+// singleConnectionError means a session lock would hold the only connection
+// the DB can open, leaving none for the migrations.
+type singleConnectionError struct{}
+
+func (e *singleConnectionError) Error() string {
+	return "The migration lock needs a connection of its own, but the DB is limited to one (SetMaxOpenConns(1)); " +
+		"allow at least two, or disable the lock with SetLocker(nil)"
+}
+
+// ChecksumMismatchError means an up migration was edited after it was
+// applied.
+type ChecksumMismatchError struct {
+	version         int
+	name            string
+	storedChecksum  string
+	currentChecksum string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf(
+		"DB migration %d (%s) was applied with checksum %s, but the file now has checksum %s",
+		e.version, e.name, e.storedChecksum, e.currentChecksum)
+}
+
+func (e *ChecksumMismatchError) Version() int            { return e.version }
+func (e *ChecksumMismatchError) Name() string            { return e.name }
+func (e *ChecksumMismatchError) StoredChecksum() string  { return e.storedChecksum }
+func (e *ChecksumMismatchError) CurrentChecksum() string { return e.currentChecksum }
+
+type schemaUpgradeError struct {
+	fromVersion int
+	toVersion   int
+	cause       error
+}
+
+func (e *schemaUpgradeError) Error() string {
+	return fmt.Sprintf(
+		"upgrading migration table from layout %d to %d: %+v",
+		e.fromVersion, e.toVersion, e.cause)
+}
+
+func (e *schemaUpgradeError) FromVersion() int { return e.fromVersion }
+func (e *schemaUpgradeError) ToVersion() int   { return e.toVersion }
+func (e *schemaUpgradeError) Cause() error     { return e.cause }
+func (e *schemaUpgradeError) Unwrap() error    { return e.cause }
+
+type schemaOutdatedError struct {
+	version  int
+	expected int
+}
+
+func (e *schemaOutdatedError) Error() string {
+	return fmt.Sprintf(
+		"migration table has layout %d, but %d is needed; run a migration to upgrade it",
+		e.version, e.expected)
+}
+
+func (e *schemaOutdatedError) Version() int  { return e.version }
+func (e *schemaOutdatedError) Expected() int { return e.expected }
+
+type partialMigrationError struct {
+	version   int
+	name      string
+	isUp      bool
+	completed int
+	cause     error
+}
+
+func (e *partialMigrationError) Error() string {
+	direction := "down"
+	if e.isUp {
+		direction = "up"
+	}
+	return fmt.Sprintf(
+		"running migration: %s migration %d (%s) failed after %d statement(s) had been committed, leaving the database partially migrated: %+v",
+		direction, e.version, e.name, e.completed, e.cause)
+}
+
+func (e *partialMigrationError) Version() int             { return e.version }
+func (e *partialMigrationError) Name() string             { return e.name }
+func (e *partialMigrationError) IsUp() bool               { return e.isUp }
+func (e *partialMigrationError) CompletedStatements() int { return e.completed }
+func (e *partialMigrationError) Cause() error             { return e.cause }
+
+type nonAtomicMigrationError struct {
+	version int
+	name    string
+	isUp    bool
+}
+
+func (e *nonAtomicMigrationError) Error() string {
+	direction := "down"
+	if e.isUp {
+		direction = "up"
+	}
+	return fmt.Sprintf(
+		"%s migration %d (%s) mixes DDL with other statements, which can't be rolled back together; split it up or mark it \"%s\"",
+		direction, e.version, e.name, strings.TrimSpace(NoTransactionPrefix))
+}
+
+func (e *nonAtomicMigrationError) Version() int { return e.version }
+func (e *nonAtomicMigrationError) Name() string { return e.name }
+func (e *nonAtomicMigrationError) IsUp() bool   { return e.isUp }
+
+// DirtyError means a migration that can't be rolled back failed part way
+// through, or is still running in another process. No more migrations will
+// run until the database is repaired by hand and Migrator.Resolve is called.
+type DirtyError struct {
+	version int
+	name    string
+	isUp    bool
+}
+
+func (e *DirtyError) Error() string {
+	direction := "down"
+	if e.isUp {
+		direction = "up"
+	}
+	return fmt.Sprintf(
+		"DB migration %d (%s) is dirty: its %s migration didn't finish. Repair the database, then call Resolve",
+		e.version, e.name, direction)
+}
+
+func (e *DirtyError) Version() int { return e.version }
+func (e *DirtyError) Name() string { return e.name }
+func (e *DirtyError) IsUp() bool   { return e.isUp }
+
+type notDirtyError struct{}
+
+func (e *notDirtyError) Error() string {
+	return "No dirty migration to resolve"
+}
+
+type goMigrationConflictError struct {
+	version      int
+	name         string
+	existingName string
+}
+
+func (e *goMigrationConflictError) Error() string {
+	return fmt.Sprintf(
+		"Go migration %d (%s) has the same version as migration %s",
+		e.version, e.name, e.existingName)
+}
+
+func (e *goMigrationConflictError) Version() int         { return e.version }
+func (e *goMigrationConflictError) Name() string         { return e.name }
+func (e *goMigrationConflictError) ExistingName() string { return e.existingName }
+
+type goMigrationScriptError struct {
+	version int
+	name    string
+}
+
+func (e *goMigrationScriptError) Error() string {
+	return fmt.Sprintf("Go migration %d (%s) can't be written to a SQL script", e.version, e.name)
+}
+
+func (e *goMigrationScriptError) Version() int { return e.version }
+func (e *goMigrationScriptError) Name() string { return e.name }
+
+type stalePlanError struct {
+	problem string
+}
+
+func (e *stalePlanError) Error() string {
+	return fmt.Sprintf("Plan no longer applies: %s", e.problem)
+}
+
+func (e *stalePlanError) Problem() string { return e.problem }
+
+type baselineNotEmptyError struct {
+	applied int
+}
+
+func (e *baselineNotEmptyError) Error() string {
+	return fmt.Sprintf(
+		"Can't baseline: the version table already has %d migration(s). Use ForceBaseline to replace them",
+		e.applied)
+}
+
+func (e *baselineNotEmptyError) Applied() int { return e.applied }
+
+type validationError struct {
+	problems []error
+}
+
+func (e *validationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d problems before migrating:", len(e.problems))
+	for _, problem := range e.problems {
+		fmt.Fprintf(&b, "\n - %v", problem)
+	}
+	return b.String()
+}
+
+func (e *validationError) Problems() []error { return e.problems }
+
+type badDirectiveError struct {
+	filename  string
+	directive string
+}
+
+func (e *badDirectiveError) Error() string {
+	return fmt.Sprintf("Migration %s starts with unknown directive %q (expected %q)",
+		e.filename, e.directive, strings.TrimSpace(NoTransactionPrefix))
+}
+
+func (e *badDirectiveError) Filename() string  { return e.filename }
+func (e *badDirectiveError) Directive() string { return e.directive }
+
+type batchNotPossibleError struct {
+	// Zero if the dialect can't roll back DDL
+	version int
+	name    string
+}
+
+func (e *batchNotPossibleError) Error() string {
+	if e.version == 0 {
+		return "Can't run migrations in one transaction: the database commits DDL immediately"
+	}
+	return fmt.Sprintf("Can't run migrations in one transaction: migration %d (%s) runs without a transaction",
+		e.version, e.name)
+}
+
+func (e *batchNotPossibleError) Version() int { return e.version }
+func (e *batchNotPossibleError) Name() string { return e.name }
+
+type batchMigrationError struct {
+	version int
+	name    string
+	isUp    bool
+	cause   error
+}
+
+func (e *batchMigrationError) Error() string {
+	direction := "down"
+	if e.isUp {
+		direction = "up"
+	}
+	return fmt.Sprintf("%s migration %d (%s) failed, so the whole batch was rolled back: %+v",
+		direction, e.version, e.name, e.cause)
+}
+
+func (e *batchMigrationError) Version() int  { return e.version }
+func (e *batchMigrationError) Name() string  { return e.name }
+func (e *batchMigrationError) IsUp() bool    { return e.isUp }
+func (e *batchMigrationError) Cause() error  { return e.cause }
+func (e *batchMigrationError) Unwrap() error { return e.cause }
+
+type hookAbortError struct {
+	hook string
+	// Zero for BeforeRun
+	version int
+	cause   error
+}
+
+func (e *hookAbortError) Error() string {
+	if e.version == 0 {
+		return fmt.Sprintf("Migration stopped by %s hook: %v", e.hook, e.cause)
+	}
+	return fmt.Sprintf("Migration stopped by %s hook for migration %d: %v", e.hook, e.version, e.cause)
+}
+
+func (e *hookAbortError) Hook() string  { return e.hook }
+func (e *hookAbortError) Version() int  { return e.version }
+func (e *hookAbortError) Cause() error  { return e.cause }
+func (e *hookAbortError) Unwrap() error { return e.cause }
@@ -0,0 +1,147 @@
+package libmigrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// fakeResult is what fakeDB returns for a query.
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+// fakeDB is a database/sql driver that records every statement it's sent.
+// Statements are answered by the first handler whose pattern matches; the
+// rest succeed with no rows.
+type fakeDB struct {
+	t        *testing.T
+	handlers []fakeHandler
+	queries  []string
+}
+
+type fakeHandler struct {
+	pattern *regexp.Regexp
+	respond func(args []driver.Value) fakeResult
+}
+
+func newFakeDB(t *testing.T) (*fakeDB, *sql.DB) {
+	f := &fakeDB{t: t}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return f, db
+}
+
+// on answers queries matching pattern (after whitespace is collapsed).
+func (f *fakeDB) on(pattern string, respond func(args []driver.Value) fakeResult) {
+	f.handlers = append(f.handlers, fakeHandler{
+		pattern: regexp.MustCompile(pattern),
+		respond: respond,
+	})
+}
+
+// onRows answers queries matching pattern with a fixed result set.
+func (f *fakeDB) onRows(pattern string, columns []string, rows ...[]driver.Value) {
+	f.on(pattern, func([]driver.Value) fakeResult {
+		return fakeResult{columns: columns, rows: rows}
+	})
+}
+
+func (f *fakeDB) onError(pattern string, err error) {
+	f.on(pattern, func([]driver.Value) fakeResult {
+		return fakeResult{err: err}
+	})
+}
+
+// matching returns the recorded queries that match pattern.
+func (f *fakeDB) matching(pattern string) (result []string) {
+	re := regexp.MustCompile(pattern)
+	for _, q := range f.queries {
+		if re.MatchString(q) {
+			result = append(result, q)
+		}
+	}
+	return
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+func (f *fakeDB) run(query string, args []driver.NamedValue) fakeResult {
+	query = strings.TrimSpace(whitespace.ReplaceAllString(query, " "))
+	f.queries = append(f.queries, query)
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	for _, h := range f.handlers {
+		if h.pattern.MatchString(query) {
+			return h.respond(values)
+		}
+	}
+	return fakeResult{}
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.t.Fatalf("unexpected Prepare: %s", query)
+	return nil, nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.run("BEGIN", nil)
+	return &fakeTx{c.db}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result := c.db.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return driver.RowsAffected(len(result.rows)), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result := c.db.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (tx *fakeTx) Commit() error {
+	tx.db.run("COMMIT", nil)
+	return nil
+}
+func (tx *fakeTx) Rollback() error {
+	tx.db.run("ROLLBACK", nil)
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
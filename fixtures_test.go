@@ -11,6 +11,14 @@ func Fixture(t *testing.T) (*migrator, *dbMock, *fsMock) {
 		listMigrations: func(ctx context.Context) ([]dbMigration, error) {
 			return []dbMigration{}, nil
 		},
+		tryLock: func(ctx context.Context) (func(context.Context) error, bool, error) {
+			return func(context.Context) error { return nil }, true, nil
+		},
+	}
+	// The version table has the current layout, so it reads the same way
+	// without RequireSchema.
+	db.readMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return db.listMigrations(ctx)
 	}
 	fs := &fsMock{
 		listMigrationDir: func() ([]string, error) {
@@ -27,39 +35,92 @@ func Fixture(t *testing.T) (*migrator, *dbMock, *fsMock) {
 	}
 
 	return &migrator{
-		db:           db,
-		filesystem:   fs,
-		outputWriter: nil,
+		db:         db,
+		dialect:    ParamTypeQuestionMark,
+		filesystem: fs,
+		logger:     nil,
 	}, db, fs
 }
 
 type dbMock struct {
-	applyMigration func(ctx context.Context, useTx, isUp bool, version int, name, query string) error
+	applyMigration func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error
+	applyGo        func(ctx context.Context, useTx, isUp bool, version int, name string, fn GoMigrationFunc) error
+	applyBatch     func(ctx context.Context, migrations []batchMigration) error
 	requireSchema  func(ctx context.Context) error
+	checkSchema    func(ctx context.Context) error
 	listMigrations func(ctx context.Context) ([]dbMigration, error)
+	readMigrations func(ctx context.Context) ([]dbMigration, error)
+	setChecksum    func(ctx context.Context, version int, checksum string) error
+	resolveDirty   func(ctx context.Context, version int, applied bool) error
+	markMigrations func(ctx context.Context, applied, unapplied []dbMigration) error
 	getVersion     func(ctx context.Context) (int, error)
+	tryLock        func(ctx context.Context) (func(context.Context) error, bool, error)
+	scriptSchema   func() string
+	scriptRecord   func(isUp bool, version int, name, checksum string) string
 	setTableName   func(name string)
 	setTableSchema func(schema string)
+	setLocker      func(locker Locker)
+	setAppliedBy   func(appliedBy string)
+	setTracer      func(tracer Tracer)
 }
 
-func (m dbMock) ApplyMigration(ctx context.Context, useTx, isUp bool, version int, name, query string) error {
-	return m.applyMigration(ctx, useTx, isUp, version, name, query)
+func (m dbMock) ApplyMigration(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+	return m.applyMigration(ctx, useTx, isUp, version, name, query, checksum)
+}
+func (m dbMock) ApplyGoMigration(ctx context.Context, useTx, isUp bool, version int, name string, fn GoMigrationFunc) error {
+	return m.applyGo(ctx, useTx, isUp, version, name, fn)
+}
+func (m dbMock) ApplyBatch(ctx context.Context, migrations []batchMigration) error {
+	return m.applyBatch(ctx, migrations)
 }
 func (m dbMock) RequireSchema(ctx context.Context) error {
 	return m.requireSchema(ctx)
 }
+func (m dbMock) CheckSchema(ctx context.Context) error {
+	return m.checkSchema(ctx)
+}
 func (m dbMock) ListMigrations(ctx context.Context) ([]dbMigration, error) {
 	return m.listMigrations(ctx)
 }
+func (m dbMock) ReadMigrations(ctx context.Context) ([]dbMigration, error) {
+	return m.readMigrations(ctx)
+}
+func (m dbMock) SetChecksum(ctx context.Context, version int, checksum string) error {
+	return m.setChecksum(ctx, version, checksum)
+}
+func (m dbMock) ResolveDirty(ctx context.Context, version int, applied bool) error {
+	return m.resolveDirty(ctx, version, applied)
+}
+func (m dbMock) MarkMigrations(ctx context.Context, applied, unapplied []dbMigration) error {
+	return m.markMigrations(ctx, applied, unapplied)
+}
 func (m dbMock) GetVersion(ctx context.Context) (int, error) {
 	return m.getVersion(ctx)
 }
+func (m dbMock) TryLock(ctx context.Context) (func(context.Context) error, bool, error) {
+	return m.tryLock(ctx)
+}
+func (m dbMock) ScriptSchema() string {
+	return m.scriptSchema()
+}
+func (m dbMock) ScriptRecord(isUp bool, version int, name, checksum string) string {
+	return m.scriptRecord(isUp, version, name, checksum)
+}
+func (m dbMock) SetTracer(tracer Tracer) {
+	m.setTracer(tracer)
+}
 func (m dbMock) SetTableName(name string) {
 	m.setTableName(name)
 }
 func (m dbMock) SetTableSchema(schema string) {
 	m.setTableSchema(schema)
 }
+func (m dbMock) SetLocker(locker Locker) {
+	m.setLocker(locker)
+}
+func (m dbMock) SetAppliedBy(appliedBy string) {
+	m.setAppliedBy(appliedBy)
+}
 
 type fsMock struct {
 	createFile         func(version int, name, direction string) (string, error)
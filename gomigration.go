@@ -0,0 +1,82 @@
+package libmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// A Querier is the transaction a Go migration runs in, or the DB if it runs
+// without one. *sql.Tx and *sql.DB both implement it.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// A GoMigrationFunc is one direction of a migration written in Go.
+type GoMigrationFunc func(ctx context.Context, db Querier) error
+
+// A GoMigration is a migration written in Go instead of SQL. It takes the
+// place of the version's .up.sql and .down.sql files, and is ordered,
+// validated and recorded in the version table like them.
+type GoMigration struct {
+	Version int
+	Name    string
+	Up      GoMigrationFunc
+	// Optional, like a .down.sql file
+	Down GoMigrationFunc
+	// If true, Up and Down get the DB instead of a transaction, like SQL
+	// migrations starting with NoTransactionPrefix.
+	NoTransaction bool
+}
+
+func (m *migrator) AddGoMigration(migration GoMigration) {
+	m.goMigrations = append(m.goMigrations, migration)
+}
+
+// addGoMigrations adds the registered Go migrations to migrationsByVersion,
+// refusing any that share a version with a file or another Go migration.
+func addGoMigrations(migrationsByVersion map[int]migration, goMigrations []GoMigration) error {
+	for i := range goMigrations {
+		goMigration := &goMigrations[i]
+
+		if existing, ok := migrationsByVersion[goMigration.Version]; ok {
+			return &goMigrationConflictError{
+				version:      goMigration.Version,
+				name:         goMigration.Name,
+				existingName: existing.Name,
+			}
+		}
+		if goMigration.Version < 1 || goMigration.Name == "" {
+			return &badMigrationFilenameError{
+				filename: goMigration.label(),
+			}
+		}
+
+		migrationsByVersion[goMigration.Version] = migration{
+			Version: goMigration.Version,
+			Name:    goMigration.Name,
+			HasUp:   goMigration.Up != nil,
+			HasDown: goMigration.Down != nil,
+			Go:      goMigration,
+		}
+	}
+
+	return nil
+}
+
+func (g *GoMigration) label() string {
+	return fmt.Sprintf("%04d_%s (Go)", g.Version, g.Name)
+}
+
+func (g *GoMigration) useTx(disableTransactions bool) bool {
+	return !disableTransactions && !g.NoTransaction
+}
+
+func (g *GoMigration) fn(isUp bool) GoMigrationFunc {
+	if isUp {
+		return g.Up
+	}
+	return g.Down
+}
@@ -0,0 +1,118 @@
+package libmigrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func noopGoMigration(ctx context.Context, db Querier) error { return nil }
+
+func TestGoMigrationsMergedWithFiles(t *testing.T) {
+	migrator := testMigrator(t)
+	migrator.AddGoMigration(GoMigration{Version: 2, Name: "second", Up: noopGoMigration})
+
+	result, err := migrator.filenamesToMigrations(context.Background(), []string{
+		"0001_first.up.sql",
+		"0001_first.down.sql",
+		"0003_third.up.sql",
+	})
+	require.NoError(t, err)
+	require.Len(t, result, 3)
+	require.Equal(t, "second", result[1].Name)
+	require.True(t, result[1].HasUp)
+	require.False(t, result[1].HasDown)
+	require.NotNil(t, result[1].Go)
+	require.Nil(t, result[2].Go)
+}
+
+func TestGoMigrationConflict(t *testing.T) {
+	migrator := testMigrator(t)
+	migrator.AddGoMigration(GoMigration{Version: 1, Name: "go", Up: noopGoMigration})
+
+	_, err := migrator.filenamesToMigrations(context.Background(), []string{
+		"0001_first.up.sql",
+	})
+	require.Equal(t, &goMigrationConflictError{
+		version:      1,
+		name:         "go",
+		existingName: "first",
+	}, err)
+}
+
+func TestMigrateToRunsGoMigration(t *testing.T) {
+	m, db, _ := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return 3, nil }
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		require.Equal(t, 3, version)
+		return nil
+	}
+	ran := false
+	m.AddGoMigration(GoMigration{
+		Version: 4,
+		Name:    "backfill",
+		Up: func(ctx context.Context, db Querier) error {
+			ran = true
+			return nil
+		},
+		NoTransaction: true,
+	})
+	db.applyGo = func(ctx context.Context, useTx, isUp bool, version int, name string, fn GoMigrationFunc) error {
+		require.False(t, useTx)
+		require.True(t, isUp)
+		require.Equal(t, 4, version)
+		require.Equal(t, "backfill", name)
+		return fn(ctx, nil)
+	}
+
+	err := m.MigrateTo(context.Background(), 4)
+	require.NoError(t, err)
+	require.True(t, ran)
+
+	// There's no down function
+	db.getVersion = func(ctx context.Context) (int, error) { return 4, nil }
+	err = m.MigrateTo(context.Background(), 3)
+	require.Equal(t, &missingMigrationError{version: 4, isUp: false}, err)
+}
+
+func TestApplyGoMigration(t *testing.T) {
+	f, db := newFakeDB(t)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   PostgresDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.ApplyGoMigration(context.Background(), true, true, 2, "backfill",
+		func(ctx context.Context, db Querier) error {
+			_, err := db.ExecContext(ctx, "UPDATE a SET b = 1")
+			return err
+		})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"BEGIN",
+		"UPDATE a SET b = 1",
+		`INSERT INTO "migration_version" (version, name, checksum, applied_at, duration_ms, applied_by, libmigrate_version) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		"COMMIT",
+	}, f.queries)
+}
+
+func TestApplyGoMigrationFailureStaysDirty(t *testing.T) {
+	// MySQL can't roll back DDL the function may have run, so the
+	// migration stays dirty.
+	f, db := newFakeDB(t)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   MySQLDialect{},
+		tableName: "migration_version",
+	}
+
+	cause := errors.New("bad row")
+	err := w.ApplyGoMigration(context.Background(), true, true, 2, "backfill",
+		func(ctx context.Context, db Querier) error { return cause })
+	require.Equal(t, cause, err)
+	require.Len(t, f.matching("dirty"), 1)
+	require.Empty(t, f.matching(`^DELETE`))
+}
@@ -0,0 +1,126 @@
+package libmigrate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// A HealthStatus describes whether the database is at the latest version.
+type HealthStatus struct {
+	// As GetVersion: a dirty migration isn't counted
+	CurrentVersion int `json:"current_version"`
+	LatestVersion  int `json:"latest_version"`
+	// Migrations on the filesystem that haven't been applied
+	Pending []MigrationStatus `json:"pending"`
+	// The migration that failed part way through, if any; see Resolve
+	Dirty *AppliedMigration `json:"dirty,omitempty"`
+}
+
+// Healthy reports whether nothing is pending or dirty.
+func (s *HealthStatus) Healthy() bool {
+	return len(s.Pending) == 0 && s.Dirty == nil
+}
+
+func (m *migrator) Health(ctx context.Context) (*HealthStatus, error) {
+	// Unlike RequireSchema, this doesn't create or upgrade the version table,
+	// so it works with read-only access.
+	err := m.db.CheckSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := m.filesystem.ListMigrationDir()
+	if err != nil {
+		return nil, err
+	}
+	migrationsByVersion, err := parseMigrationFilenames(names, m.goMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	currVersion, err := m.db.GetVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dbMigrations, err := m.db.ListMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &HealthStatus{
+		CurrentVersion: currVersion,
+		Pending:        []MigrationStatus{},
+	}
+	for _, status := range migrationStatus(sortMigrations(migrationsByVersion), dbMigrations) {
+		if !status.OnFilesystem {
+			continue
+		}
+		if status.Version > result.LatestVersion {
+			result.LatestVersion = status.Version
+		}
+		if !status.Applied {
+			result.Pending = append(result.Pending, status)
+		}
+	}
+	for i := len(dbMigrations) - 1; i >= 0; i-- {
+		if dbMigrations[i].Dirty != "" {
+			dirty := dbMigrations[i].applied()
+			result.Dirty = &dirty
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// A HealthHandler serves a Migrator's HealthStatus as JSON, e.g. for a
+// readiness probe. The status codes can be changed after NewHealthHandler.
+type HealthHandler struct {
+	Migrator Migrator
+	// Default: 200
+	HealthyStatus int
+	// When migrations are pending. Default: 503
+	PendingStatus int
+	// When a migration is dirty. Default: 503
+	DirtyStatus int
+	// When the status can't be read. Default: 503
+	ErrorStatus int
+}
+
+func NewHealthHandler(migrator Migrator) *HealthHandler {
+	return &HealthHandler{
+		Migrator:      migrator,
+		HealthyStatus: http.StatusOK,
+		PendingStatus: http.StatusServiceUnavailable,
+		DirtyStatus:   http.StatusServiceUnavailable,
+		ErrorStatus:   http.StatusServiceUnavailable,
+	}
+}
+
+type healthResponse struct {
+	*HealthStatus
+	Error string `json:"error,omitempty"`
+}
+
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Migrator.Health(r.Context())
+
+	var code int
+	response := healthResponse{HealthStatus: status}
+	switch {
+	case err != nil:
+		code = h.ErrorStatus
+		response.Error = err.Error()
+	case status.Dirty != nil:
+		code = h.DirtyStatus
+	case len(status.Pending) > 0:
+		code = h.PendingStatus
+	default:
+		code = h.HealthyStatus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
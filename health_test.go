@@ -0,0 +1,108 @@
+package libmigrate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func healthFixture(t *testing.T, dbMigrations ...dbMigration) *migrator {
+	m, db, _ := Fixture(t)
+	db.requireSchema = func(ctx context.Context) error {
+		t.Fatal("Health must not write to the database")
+		return nil
+	}
+	db.checkSchema = func(ctx context.Context) error { return nil }
+	db.getVersion = func(ctx context.Context) (int, error) {
+		version := 0
+		for _, migration := range dbMigrations {
+			if migration.Dirty == "" {
+				version = migration.Version
+			}
+		}
+		return version, nil
+	}
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) { return dbMigrations, nil }
+	return m
+}
+
+func serveHealth(t *testing.T, handler http.Handler) (int, map[string]interface{}) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	return recorder.Code, body
+}
+
+func TestHealth(t *testing.T) {
+	m := healthFixture(t, dbMigration{Version: 1, Name: "v1"})
+
+	status, err := m.Health(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, status.CurrentVersion)
+	require.Equal(t, 3, status.LatestVersion)
+	require.Len(t, status.Pending, 2)
+	require.Equal(t, 2, status.Pending[0].Version)
+	require.Equal(t, "v3", status.Pending[1].Name)
+	require.Nil(t, status.Dirty)
+	require.False(t, status.Healthy())
+
+	code, body := serveHealth(t, NewHealthHandler(m))
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, float64(1), body["current_version"])
+	require.Equal(t, float64(3), body["latest_version"])
+	require.Len(t, body["pending"], 2)
+	require.NotContains(t, body, "dirty")
+}
+
+func TestHealthHealthy(t *testing.T) {
+	m := healthFixture(t,
+		dbMigration{Version: 1, Name: "v1"},
+		dbMigration{Version: 2, Name: "v2"},
+		dbMigration{Version: 3, Name: "v3"})
+
+	code, body := serveHealth(t, NewHealthHandler(m))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []interface{}{}, body["pending"])
+}
+
+func TestHealthDirty(t *testing.T) {
+	m := healthFixture(t,
+		dbMigration{Version: 1, Name: "v1"},
+		dbMigration{Version: 2, Name: "v2", Dirty: dirtyUp})
+	handler := NewHealthHandler(m)
+	handler.DirtyStatus = http.StatusInternalServerError
+
+	code, body := serveHealth(t, handler)
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Equal(t, float64(1), body["current_version"])
+	require.Equal(t, float64(2), body["dirty"].(map[string]interface{})["version"])
+}
+
+func TestHealthError(t *testing.T) {
+	m, db, _ := Fixture(t)
+	db.checkSchema = func(ctx context.Context) error {
+		return &schemaOutdatedError{version: 0, expected: len(metaMigrations)}
+	}
+	handler := NewHealthHandler(m)
+	handler.ErrorStatus = http.StatusTeapot
+
+	code, body := serveHealth(t, handler)
+	require.Equal(t, http.StatusTeapot, code)
+	require.Contains(t, body["error"], "run a migration to upgrade it")
+}
+
+func TestHealthPendingStatus(t *testing.T) {
+	m := healthFixture(t)
+	handler := NewHealthHandler(m)
+	handler.PendingStatus = http.StatusOK
+
+	code, _ := serveHealth(t, handler)
+	require.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,98 @@
+package libmigrate
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const modulePath = "github.com/ojrac/libmigrate"
+
+// An AppliedMigration is a row of the migration version table.
+type AppliedMigration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	// SHA-256 of the up migration, hex encoded
+	Checksum string `json:"checksum,omitempty"`
+
+	// These are zero for migrations applied by older versions of libmigrate.
+	AppliedAt time.Time     `json:"applied_at"`
+	Duration  time.Duration `json:"duration"`
+	// Set with SetAppliedBy, e.g. a deploy ID or username
+	AppliedBy string `json:"applied_by,omitempty"`
+	// Version of libmigrate that applied the migration
+	LibmigrateVersion string `json:"libmigrate_version,omitempty"`
+	// The migration ran outside a transaction and failed, or is still
+	// running. See Migrator.Resolve.
+	Dirty bool `json:"dirty"`
+}
+
+func (m *migrator) SetAppliedBy(appliedBy string) {
+	m.db.SetAppliedBy(appliedBy)
+}
+
+func (m *migrator) History(ctx context.Context) (result []AppliedMigration, err error) {
+	err = m.db.RequireSchema(ctx)
+	if err != nil {
+		return
+	}
+
+	dbMigrations, err := m.db.ListMigrations(ctx)
+	if err != nil {
+		return
+	}
+
+	result = make([]AppliedMigration, len(dbMigrations))
+	for i, dbMigration := range dbMigrations {
+		result[i] = dbMigration.applied()
+	}
+	return
+}
+
+func (m dbMigration) applied() AppliedMigration {
+	return AppliedMigration{
+		Version:           m.Version,
+		Name:              m.Name,
+		Checksum:          m.Checksum,
+		AppliedAt:         m.AppliedAt,
+		Duration:          m.Duration,
+		AppliedBy:         m.AppliedBy,
+		LibmigrateVersion: m.LibmigrateVersion,
+		Dirty:             m.Dirty != "",
+	}
+}
+
+var (
+	libraryVersionOnce sync.Once
+	libraryVersionStr  string
+)
+
+// libraryVersion is the version of this module the binary was built with, or
+// "(devel)" if it can't tell.
+func libraryVersion() string {
+	libraryVersionOnce.Do(func() {
+		libraryVersionStr = "(devel)"
+
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+
+		if info.Main.Path == modulePath && info.Main.Version != "" {
+			libraryVersionStr = info.Main.Version
+			return
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				libraryVersionStr = dep.Version
+				if dep.Replace != nil && dep.Replace.Version != "" {
+					libraryVersionStr = dep.Replace.Version
+				}
+				return
+			}
+		}
+	})
+
+	return libraryVersionStr
+}
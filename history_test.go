@@ -0,0 +1,47 @@
+package libmigrate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	appliedAt := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	m, db, _ := Fixture(t)
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{
+			{Version: 1, Name: "v1"},
+			{
+				Version:           2,
+				Name:              "v2",
+				Checksum:          "abc",
+				AppliedAt:         appliedAt,
+				Duration:          1500 * time.Millisecond,
+				AppliedBy:         "deploy-42",
+				LibmigrateVersion: "v1.2.3",
+			},
+		}, nil
+	}
+
+	history, err := m.History(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []AppliedMigration{
+		{Version: 1, Name: "v1"},
+		{
+			Version:           2,
+			Name:              "v2",
+			Checksum:          "abc",
+			AppliedAt:         appliedAt,
+			Duration:          1500 * time.Millisecond,
+			AppliedBy:         "deploy-42",
+			LibmigrateVersion: "v1.2.3",
+		},
+	}, history)
+}
+
+func TestLibraryVersion(t *testing.T) {
+	require.NotEmpty(t, libraryVersion())
+}
@@ -0,0 +1,96 @@
+package libmigrate
+
+import (
+	"context"
+	"time"
+)
+
+// Hooks are called around a run of MigrateTo (or MigrateLatest, Up, Down,
+// Redo and ApplyPlan) and around each migration it applies. Any of them may
+// be nil. They aren't called for dry runs.
+type Hooks struct {
+	// Returning an error stops the run before any migrations are applied.
+	BeforeRun func(ctx context.Context, run RunEvent) error
+	AfterRun  func(ctx context.Context, run RunEvent)
+	// Returning an error stops the run before this migration is applied.
+	BeforeMigration func(ctx context.Context, migration MigrationEvent) error
+	// In a batch (see SetBatchMode), this is called before the batch's
+	// transaction commits.
+	AfterMigration func(ctx context.Context, migration MigrationEvent)
+}
+
+type RunEvent struct {
+	FromVersion int
+	ToVersion   int
+	// Set for AfterRun
+	Duration time.Duration
+	Err      error
+}
+
+type MigrationEvent struct {
+	Version int
+	Name    string
+	IsUp    bool
+	// Set for AfterMigration
+	Duration time.Duration
+	Err      error
+}
+
+func (m *migrator) SetHooks(hooks Hooks) {
+	m.hooks = hooks
+}
+
+func (m *migrator) beforeRun(ctx context.Context, fromVersion, toVersion int) error {
+	if m.hooks.BeforeRun == nil {
+		return nil
+	}
+
+	err := m.hooks.BeforeRun(ctx, RunEvent{FromVersion: fromVersion, ToVersion: toVersion})
+	if err != nil {
+		return &hookAbortError{hook: "BeforeRun", cause: err}
+	}
+	return nil
+}
+
+func (m *migrator) afterRun(ctx context.Context, fromVersion, toVersion int, duration time.Duration, err error) {
+	if m.hooks.AfterRun == nil {
+		return
+	}
+
+	m.hooks.AfterRun(ctx, RunEvent{
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Duration:    duration,
+		Err:         err,
+	})
+}
+
+func (m *migrator) beforeMigration(ctx context.Context, step PlanStep) error {
+	if m.hooks.BeforeMigration == nil {
+		return nil
+	}
+
+	err := m.hooks.BeforeMigration(ctx, migrationEvent(step, 0, nil))
+	if err != nil {
+		return &hookAbortError{hook: "BeforeMigration", version: step.Version, cause: err}
+	}
+	return nil
+}
+
+func (m *migrator) afterMigration(ctx context.Context, step PlanStep, duration time.Duration, err error) {
+	if m.hooks.AfterMigration == nil {
+		return
+	}
+
+	m.hooks.AfterMigration(ctx, migrationEvent(step, duration, err))
+}
+
+func migrationEvent(step PlanStep, duration time.Duration, err error) MigrationEvent {
+	return MigrationEvent{
+		Version:  step.Version,
+		Name:     step.Name,
+		IsUp:     step.IsUp,
+		Duration: duration,
+		Err:      err,
+	}
+}
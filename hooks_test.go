@@ -0,0 +1,112 @@
+package libmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordHooks logs each hook call.
+func recordHooks(calls *[]string) Hooks {
+	return Hooks{
+		BeforeRun: func(ctx context.Context, run RunEvent) error {
+			*calls = append(*calls, fmt.Sprintf("before run %d-%d", run.FromVersion, run.ToVersion))
+			return nil
+		},
+		AfterRun: func(ctx context.Context, run RunEvent) {
+			*calls = append(*calls, fmt.Sprintf("after run %v", run.Err))
+		},
+		BeforeMigration: func(ctx context.Context, migration MigrationEvent) error {
+			*calls = append(*calls, fmt.Sprintf("before %d", migration.Version))
+			return nil
+		},
+		AfterMigration: func(ctx context.Context, migration MigrationEvent) {
+			*calls = append(*calls, fmt.Sprintf("after %d %v", migration.Version, migration.Err))
+		},
+	}
+}
+
+func TestHooks(t *testing.T) {
+	m, db, _ := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	cause := errors.New("failed")
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		if version == 2 {
+			return cause
+		}
+		return nil
+	}
+	var calls []string
+	m.SetHooks(recordHooks(&calls))
+
+	err := m.MigrateTo(context.Background(), 3)
+	require.Equal(t, cause, err)
+	require.Equal(t, []string{
+		"before run 0-3",
+		"before 1",
+		"after 1 <nil>",
+		"before 2",
+		"after 2 failed",
+		"after run failed",
+	}, calls)
+}
+
+func TestHooksBatch(t *testing.T) {
+	m, db, _ := Fixture(t)
+	m.SetBatchMode(BatchRequired)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	db.applyBatch = func(ctx context.Context, migrations []batchMigration) error {
+		for _, migration := range migrations {
+			_, err := migration.Before(ctx)
+			require.NoError(t, err)
+			migration.After(ctx, 0, nil)
+		}
+		return nil
+	}
+	var calls []string
+	m.SetHooks(recordHooks(&calls))
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"before run 0-2",
+		"before 1",
+		"after 1 <nil>",
+		"before 2",
+		"after 2 <nil>",
+		"after run <nil>",
+	}, calls)
+}
+
+func TestBeforeHookAborts(t *testing.T) {
+	m, db, _ := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	var applied []int
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		applied = append(applied, version)
+		return nil
+	}
+	cause := errors.New("maintenance window closed")
+	m.SetHooks(Hooks{
+		BeforeMigration: func(ctx context.Context, migration MigrationEvent) error {
+			if migration.Version == 2 {
+				return cause
+			}
+			return nil
+		},
+	})
+
+	err := m.MigrateTo(context.Background(), 3)
+	require.Equal(t, &hookAbortError{hook: "BeforeMigration", version: 2, cause: cause}, err)
+	require.True(t, errors.Is(err, cause))
+	require.Equal(t, []int{1}, applied)
+
+	m.SetHooks(Hooks{
+		BeforeRun: func(ctx context.Context, run RunEvent) error { return cause },
+	})
+	err = m.MigrateTo(context.Background(), 3)
+	require.Equal(t, &hookAbortError{hook: "BeforeRun", cause: cause}, err)
+}
@@ -2,27 +2,31 @@ package libmigrate
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const filenameFmt = "%04d_%s.%s.sql"
 
 type migrator struct {
 	db                  dbWrapper
+	dialect             Dialect
 	filesystem          filesystemWrapper
 	disableTransactions bool
-	outputWriter        io.Writer
-}
-
-func (m *migrator) printf(format string, a ...interface{}) {
-	if m.outputWriter == nil {
-		return
-	}
-
-	fmt.Fprintf(m.outputWriter, format, a...)
+	logger              Logger
+	lockTimeout         time.Duration
+	skipChecksums       bool
+	requireAtomic       bool
+	goMigrations        []GoMigration
+	dryRun              bool
+	batchMode           BatchMode
+	hooks               Hooks
+	observers           []Observer
+	tracer              Tracer
 }
 
 type paramFunc func() string
@@ -47,11 +51,20 @@ type migration struct {
 	Name    string
 	HasUp   bool
 	HasDown bool
+	Go      *GoMigration // Nil for SQL files
 }
 
 type dbMigration struct {
-	Version int
-	Name    string
+	Version  int
+	Name     string
+	Checksum string // Empty if the migration was applied without one
+
+	// Empty for migrations applied by older versions of libmigrate
+	AppliedAt         time.Time
+	Duration          time.Duration
+	AppliedBy         string
+	LibmigrateVersion string
+	Dirty             string // dirtyUp or dirtyDown, if set
 }
 
 func (m migration) Filename(isUp bool) string {
@@ -62,14 +75,45 @@ func (m migration) Filename(isUp bool) string {
 	return fmt.Sprintf(filenameFmt, m.Version, m.Name, direction)
 }
 
+// label names one direction of a migration in output.
+func (m migration) label(isUp bool) string {
+	if m.Go == nil {
+		return m.Filename(isUp)
+	}
+
+	direction := "up"
+	if !isUp {
+		direction = "down"
+	}
+	return fmt.Sprintf("%04d_%s.%s (Go)", m.Version, m.Name, direction)
+}
+
 func (m *migrator) listMigrations(ctx context.Context) (result []migration, err error) {
-	err = m.db.RequireSchema(ctx)
+	result, checksumProblems, err := m.listMigrationsDeferred(ctx)
+	if err == nil {
+		err = newValidationError(checksumProblems)
+	}
 	if err != nil {
-		return
+		return nil, err
+	}
+	return
+}
+
+// listMigrationsDeferred is listMigrations, except that checksum problems are
+// returned for the caller to report along with any others.
+func (m *migrator) listMigrationsDeferred(ctx context.Context) (result []migration, checksumProblems []error, err error) {
+	if !m.readOnly(ctx) {
+		err = m.db.RequireSchema(ctx)
+		if err != nil {
+			return
+		}
 	}
 
 	names, err := m.filesystem.ListMigrationDir()
-	return m.filenamesToMigrations(ctx, names)
+	if err != nil {
+		return
+	}
+	return m.filenamesToMigrationsDeferred(ctx, names)
 }
 
 func checkMigrationName(m migration, filename string, isUp bool) error {
@@ -86,7 +130,35 @@ func checkMigrationName(m migration, filename string, isUp bool) error {
 }
 
 func (m *migrator) filenamesToMigrations(ctx context.Context, names []string) (result []migration, err error) {
-	migrationsByVersion := make(map[int]migration, len(names)/2)
+	result, checksumProblems, err := m.filenamesToMigrationsDeferred(ctx, names)
+	if err == nil {
+		err = newValidationError(checksumProblems)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (m *migrator) filenamesToMigrationsDeferred(ctx context.Context, names []string) (result []migration, checksumProblems []error, err error) {
+	migrationsByVersion, err := parseMigrationFilenames(names, m.goMigrations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checksumProblems, err = m.testForUnknownMigrations(ctx, migrationsByVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sortMigrations(migrationsByVersion), checksumProblems, nil
+}
+
+// parseMigrationFilenames checks the filesystem's migrations, merged with the
+// registered Go migrations, for gaps and naming problems, without looking at
+// the DB.
+func parseMigrationFilenames(names []string, goMigrations []GoMigration) (migrationsByVersion map[int]migration, err error) {
+	migrationsByVersion = make(map[int]migration, len(names)/2)
 
 	for _, s := range names {
 		up := strings.HasSuffix(s, ".up.sql")
@@ -140,7 +212,7 @@ func (m *migrator) filenamesToMigrations(ctx context.Context, names []string) (r
 				upName:   upName,
 				downName: downName,
 			}
-			return
+			return nil, err
 		} else {
 			if err := checkMigrationName(m, s, up); err != nil {
 				return nil, err
@@ -155,28 +227,46 @@ func (m *migrator) filenamesToMigrations(ctx context.Context, names []string) (r
 		}
 	}
 
-	err = validateMigrations(true, migrationsByVersion)
+	err = addGoMigrations(migrationsByVersion, goMigrations)
 	if err != nil {
 		return nil, err
 	}
 
-	err = m.testForUnknownMigrations(ctx, migrationsByVersion)
+	err = validateMigrations(true, migrationsByVersion)
 	if err != nil {
 		return nil, err
 	}
 
+	return migrationsByVersion, nil
+}
+
+// sortMigrations expects migrationsByVersion to have passed
+// validateMigrations.
+func sortMigrations(migrationsByVersion map[int]migration) []migration {
 	// At this point, we've checked that migrationsByVersion has migrations
 	// from 1 to N, so we can directly write to result[i].
-	result = make([]migration, len(migrationsByVersion))
+	result := make([]migration, len(migrationsByVersion))
 	for version, m := range migrationsByVersion {
 		result[version-1] = m
 	}
-	return
+	return result
 }
 
-func (m *migrator) testForUnknownMigrations(ctx context.Context, migrations map[int]migration) (err error) {
-	dbMigrations, err := m.db.ListMigrations(ctx)
+func (m *migrator) testForUnknownMigrations(ctx context.Context, migrations map[int]migration) (checksumProblems []error, err error) {
+	dbMigrations, err := m.readMigrations(ctx)
+	if err != nil {
+		return
+	}
+
+	err = matchDbMigrations(dbMigrations, migrations)
+	if err != nil || m.skipChecksums {
+		return
+	}
 
+	return m.verifyChecksums(dbMigrations, migrations), nil
+}
+
+func matchDbMigrations(dbMigrations []dbMigration, migrations map[int]migration) error {
 	for _, dbMigration := range dbMigrations {
 		fsMigration, ok := migrations[dbMigration.Version]
 		if !ok {
@@ -197,6 +287,112 @@ func (m *migrator) testForUnknownMigrations(ctx context.Context, migrations map[
 	return nil
 }
 
+// verifyChecksums compares each applied migration's up file with the
+// checksum recorded when it ran. Migrations applied before checksums were
+// recorded, and Go migrations, are skipped. It returns every problem found.
+func (m *migrator) verifyChecksums(dbMigrations []dbMigration, migrations map[int]migration) (problems []error) {
+	for _, dbMigration := range dbMigrations {
+		if dbMigration.Checksum == "" || migrations[dbMigration.Version].Go != nil {
+			continue
+		}
+
+		sqlString, err := m.filesystem.ReadMigration(migrations[dbMigration.Version].Filename(true))
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+
+		if current := checksum(sqlString); current != dbMigration.Checksum {
+			problems = append(problems, &ChecksumMismatchError{
+				version:         dbMigration.Version,
+				name:            dbMigration.Name,
+				storedChecksum:  dbMigration.Checksum,
+				currentChecksum: current,
+			})
+		}
+	}
+
+	return
+}
+
+// checksum identifies the contents of an up migration.
+func checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// readOnlyKey marks a context in which the migrator mustn't create or
+// upgrade the version table, as for a dry run; see withReadOnly.
+type readOnlyKey struct{}
+
+// withReadOnly makes the reads below read-only for ctx, e.g. for Plan.
+func withReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+// readOnly reports whether the version table must be left as it is: in dry
+// runs, and in contexts from withReadOnly.
+func (m *migrator) readOnly(ctx context.Context) bool {
+	return m.dryRun || ctx.Value(readOnlyKey{}) != nil
+}
+
+// readMigrations lists the version table, without creating or upgrading it
+// when read-only.
+func (m *migrator) readMigrations(ctx context.Context) ([]dbMigration, error) {
+	if m.readOnly(ctx) {
+		return m.db.ReadMigrations(ctx)
+	}
+	return m.db.ListMigrations(ctx)
+}
+
+// currentVersion is GetVersion, without creating or upgrading the version
+// table when read-only.
+func (m *migrator) currentVersion(ctx context.Context) (int, error) {
+	if !m.readOnly(ctx) {
+		return m.GetVersion(ctx)
+	}
+
+	dbMigrations, err := m.db.ReadMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for _, dbMigration := range dbMigrations {
+		if dbMigration.Dirty == "" && dbMigration.Version > version {
+			version = dbMigration.Version
+		}
+	}
+	return version, nil
+}
+
+// requireClean returns a *DirtyError if a migration is dirty.
+func (m *migrator) requireClean(ctx context.Context) error {
+	dbMigration, err := m.findDirty(ctx)
+	if err != nil || dbMigration == nil {
+		return err
+	}
+
+	return &DirtyError{
+		version: dbMigration.Version,
+		name:    dbMigration.Name,
+		isUp:    dbMigration.Dirty == dirtyUp,
+	}
+}
+
+func (m *migrator) findDirty(ctx context.Context) (*dbMigration, error) {
+	dbMigrations, err := m.readMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(dbMigrations) - 1; i >= 0; i-- {
+		if dbMigrations[i].Dirty != "" {
+			return &dbMigrations[i], nil
+		}
+	}
+	return nil, nil
+}
+
 func validateMigrations(isUp bool, migrations map[int]migration) error {
 	for i := 0; i < len(migrations); i++ {
 		version := i + 1
@@ -226,25 +422,62 @@ func (m *migrator) useTx(sql string) bool {
 	return true
 }
 
-func (m *migrator) internalMigrate(ctx context.Context, migration migration, isUp bool) (err error) {
-	if (isUp && !migration.HasUp) || (!isUp && !migration.HasDown) {
-		return &missingMigrationError{
-			version: migration.Version,
-			isUp:    isUp,
-		}
-	}
+// isAtomic reports whether a step's transaction rolls it back as a whole if
+// it fails. Steps without a transaction are tracked as dirty instead.
+func (m *migrator) isAtomic(step PlanStep) bool {
+	return step.IsGo || !step.UseTransaction || m.dialect.TransactionalDDL() ||
+		isAtomicWithoutTransactionalDDL(splitStatementsFor(m.dialect, step.SQL))
+}
 
-	note := "+"
-	if !isUp {
-		note = "-"
+func nonAtomicError(step PlanStep) error {
+	return &nonAtomicMigrationError{
+		version: step.Version,
+		name:    step.Name,
+		isUp:    step.IsUp,
 	}
-	m.printf(" %s %s\n", note, migration.Filename(isUp))
+}
+
+// applyStep runs a step planned for migration.
+func (m *migrator) applyStep(ctx context.Context, migration migration, step PlanStep) (err error) {
+	transaction := transactionMode(step.UseTransaction)
+	ctx, endMigration := m.startMigration(ctx, step, transaction)
+	defer func() {
+		endMigration(err)
+	}()
 
-	sqlString, err := m.filesystem.ReadMigration(migration.Filename(isUp))
+	err = m.beforeMigration(ctx, step)
 	if err != nil {
 		return
 	}
+	start := time.Now()
+	defer func() {
+		m.stepFinished(ctx, step, time.Since(start), err)
+		m.afterMigration(ctx, step, time.Since(start), err)
+	}()
+
+	isUp := step.IsUp
+	m.stepStarted(ctx, step, transaction)
+
+	if migration.Go != nil {
+		return m.db.ApplyGoMigration(ctx, step.UseTransaction, isUp,
+			migration.Version, migration.Name, migration.Go.fn(isUp))
+	}
+
+	var sum string
+	if isUp {
+		sum = checksum(step.SQL)
+	}
 
-	useTx := m.useTx(sqlString)
-	return m.db.ApplyMigration(ctx, useTx, isUp, migration.Version, migration.Name, sqlString)
+	if !m.isAtomic(step) {
+		if m.requireAtomic {
+			return nonAtomicError(step)
+		}
+		m.log(ctx, stepEvent(step, LogWarn, "DDL is committed immediately, so this migration can't be rolled back if it fails"))
+	}
+
+	err = m.db.ApplyMigration(ctx, step.UseTransaction, isUp, migration.Version, migration.Name, step.SQL, sum)
+	if _, ok := err.(*partialMigrationError); ok {
+		m.log(ctx, stepEvent(step, LogWarn, fmt.Sprintf("%s was partially applied; repair the database, then call Resolve", step.Filename)))
+	}
+	return err
 }
@@ -4,27 +4,41 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 )
 
 type dbWrapper interface {
-	ApplyMigration(ctx context.Context, useTx, isUp bool, version int, name, query string) error
+	ApplyMigration(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error
+	ApplyGoMigration(ctx context.Context, useTx, isUp bool, version int, name string, fn GoMigrationFunc) error
+	ApplyBatch(ctx context.Context, migrations []batchMigration) error
 	RequireSchema(ctx context.Context) error
+	CheckSchema(ctx context.Context) error
 	ListMigrations(ctx context.Context) ([]dbMigration, error)
+	ReadMigrations(ctx context.Context) ([]dbMigration, error)
+	SetChecksum(ctx context.Context, version int, checksum string) error
+	ResolveDirty(ctx context.Context, version int, applied bool) error
+	MarkMigrations(ctx context.Context, applied, unapplied []dbMigration) error
 	GetVersion(ctx context.Context) (int, error)
+	TryLock(ctx context.Context) (unlock func(context.Context) error, acquired bool, err error)
+	ScriptSchema() string
+	ScriptRecord(isUp bool, version int, name, checksum string) string
 
 	SetTableName(name string)
 	SetTableSchema(schema string)
+	SetLocker(locker Locker)
+	SetAppliedBy(appliedBy string)
+	SetTracer(tracer Tracer)
 }
 
 type dbWrapperImpl struct {
 	db          DB
-	paramType   ParamType
+	dialect     Dialect
 	tableSchema string
 	tableName   string
-}
-
-type dbOrTx interface {
-	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	locker      Locker
+	lockerSet   bool // If false, use the dialect's default
+	appliedBy   string
+	tracer      Tracer
 }
 
 func (db *dbWrapperImpl) SetTableName(name string) {
@@ -35,8 +49,57 @@ func (db *dbWrapperImpl) SetTableSchema(schema string) {
 	db.tableSchema = schema
 }
 
-func (w *dbWrapperImpl) ApplyMigration(ctx context.Context, useTx, isUp bool, version int, name, query string) (err error) {
-	var db dbOrTx = w.db
+func (db *dbWrapperImpl) SetLocker(locker Locker) {
+	db.locker = locker
+	db.lockerSet = true
+}
+
+func (db *dbWrapperImpl) SetAppliedBy(appliedBy string) {
+	db.appliedBy = appliedBy
+}
+
+func (w *dbWrapperImpl) TryLock(ctx context.Context) (unlock func(context.Context) error, acquired bool, err error) {
+	locker := w.locker
+	if !w.lockerSet {
+		locker = w.dialect.Locker(w.tableSchema, w.tableName)
+	}
+	if locker == nil {
+		return func(context.Context) error { return nil }, true, nil
+	}
+
+	return locker.TryLock(ctx, w.db)
+}
+
+func (w *dbWrapperImpl) ApplyMigration(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+	return w.applyMigration(ctx, useTx, isUp, version, name, checksum,
+		func(ctx context.Context, db Querier) (executedStatements, error) {
+			return w.execMigration(ctx, db, query)
+		})
+}
+
+// Go migrations aren't split, so a failure is never known to be clean or
+// partial unless it ran in a transaction with transactional DDL.
+func (w *dbWrapperImpl) ApplyGoMigration(ctx context.Context, useTx, isUp bool, version int, name string, fn GoMigrationFunc) error {
+	return w.applyMigration(ctx, useTx, isUp, version, name, "",
+		func(ctx context.Context, db Querier) (executedStatements, error) {
+			return executedStatements{}, fn(ctx, db)
+		})
+}
+
+// applyMigration runs exec and records the result in the version table.
+func (w *dbWrapperImpl) applyMigration(ctx context.Context, useTx, isUp bool, version int, name, checksum string,
+	exec func(ctx context.Context, db Querier) (executedStatements, error)) (err error) {
+	// If a failure can't be rolled back, the migration is marked dirty while
+	// it runs, so a failure part way through isn't mistaken for either state.
+	tracked := !useTx || !w.dialect.TransactionalDDL()
+	if tracked {
+		err = w.markDirty(ctx, isUp, version, name, checksum)
+		if err != nil {
+			return
+		}
+	}
+
+	var db Querier = w.db
 	if useTx {
 		var tx *sql.Tx
 		tx, err = w.db.BeginTx(ctx, nil)
@@ -54,45 +117,263 @@ func (w *dbWrapperImpl) ApplyMigration(ctx context.Context, useTx, isUp bool, ve
 		}()
 	}
 
-	_, err = db.ExecContext(ctx, query)
+	start := time.Now()
+	completed, err := exec(ctx, db)
+	if err != nil {
+		if tracked && completed.clean(useTx) {
+			// Nothing changed, so it's safe to retry. If this fails, the
+			// migration stays dirty, which is also safe.
+			w.unmarkDirty(ctx, isUp, version, name)
+		}
+		if completed.partial(useTx) {
+			return &partialMigrationError{
+				version:   version,
+				name:      name,
+				isUp:      isUp,
+				completed: completed.statements,
+				cause:     err,
+			}
+		}
+		return err
+	}
+	duration := time.Since(start)
+
+	switch {
+	case isUp && tracked:
+		return w.finishDirty(ctx, db, version, start, duration)
+	case isUp:
+		return w.recordApplied(ctx, db, version, name, checksum, start, duration)
+	default:
+		return w.recordUnapplied(ctx, db, version, name)
+	}
+}
+
+// recordApplied adds a migration to the version table.
+func (w *dbWrapperImpl) recordApplied(ctx context.Context, db Querier, version int, name, checksum string, appliedAt time.Time, duration time.Duration) error {
+	paramFunc, err := dialectParams(w.dialect)
 	if err != nil {
-		return &migrateError{cause: err}
+		return err
 	}
 
-	paramFunc, err := w.paramType.getFunc()
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s
+					(version, name, checksum, applied_at, duration_ms, applied_by, libmigrate_version)
+			 VALUES (%s, %s, %s, %s, %s, %s, %s)
+	`, w.fullTableName(), paramFunc(), paramFunc(), paramFunc(), paramFunc(), paramFunc(), paramFunc(), paramFunc()),
+		version, name, checksum,
+		appliedAt.UTC().Format(time.RFC3339), duration.Milliseconds(),
+		sql.NullString{String: w.appliedBy, Valid: w.appliedBy != ""},
+		libraryVersion())
+	return err
+}
+
+// recordUnapplied removes a migration from the version table.
+func (w *dbWrapperImpl) recordUnapplied(ctx context.Context, db Querier, version int, name string) error {
+	paramFunc, err := dialectParams(w.dialect)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`
+		DELETE FROM %s
+			  WHERE version = %s
+					AND name = %s
+	`, w.fullTableName(), paramFunc(), paramFunc()),
+		version, name)
+	return err
+}
+
+// MarkMigrations records migrations as applied or not, without running them,
+// in one transaction. Applied migrations need Version, Name and Checksum;
+// unapplied migrations need Version and Name.
+func (w *dbWrapperImpl) MarkMigrations(ctx context.Context, applied, unapplied []dbMigration) (err error) {
+	tx, err := w.db.BeginTx(ctx, nil)
 	if err != nil {
 		return
 	}
+	defer func() {
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	for _, m := range unapplied {
+		err = w.recordUnapplied(ctx, tx, m.Version, m.Name)
+		if err != nil {
+			return
+		}
+	}
+	for _, m := range applied {
+		err = w.recordApplied(ctx, tx, m.Version, m.Name, m.Checksum, time.Now(), 0)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// markDirty records that a migration is about to run. An up migration is
+// added to the version table, and a down migration is left there, until it
+// finishes.
+func (w *dbWrapperImpl) markDirty(ctx context.Context, isUp bool, version int, name, checksum string) error {
+	paramFunc, err := dialectParams(w.dialect)
+	if err != nil {
+		return err
+	}
+
 	if isUp {
-		_, err = db.ExecContext(ctx, fmt.Sprintf(`
+		_, err = w.db.ExecContext(ctx, fmt.Sprintf(`
 			INSERT INTO %s
-						(version, name)
-				 VALUES (%s, %s)
-		`, w.fullTableName(), paramFunc(), paramFunc()),
-			version, name)
-	} else {
-		_, err = db.ExecContext(ctx, fmt.Sprintf(`
-			DELETE FROM %s
-				  WHERE version = %s
-						AND name = %s
-		`, w.fullTableName(), paramFunc(), paramFunc()),
-			version, name)
+						(version, name, checksum, applied_by, libmigrate_version, dirty)
+				 VALUES (%s, %s, %s, %s, %s, %s)
+		`, w.fullTableName(), paramFunc(), paramFunc(), paramFunc(), paramFunc(), paramFunc(), paramFunc()),
+			version, name, checksum,
+			sql.NullString{String: w.appliedBy, Valid: w.appliedBy != ""},
+			libraryVersion(), dirtyUp)
+		return err
 	}
+
+	_, err = w.db.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s
+		   SET dirty = %s
+		 WHERE version = %s
+	`, w.fullTableName(), paramFunc(), paramFunc()),
+		dirtyDown, version)
 	return err
 }
 
-func (w *dbWrapperImpl) RequireSchema(ctx context.Context) error {
-	_, err := w.db.ExecContext(ctx, fmt.Sprintf(`
-	CREATE TABLE IF NOT EXISTS %s (
-		version integer PRIMARY KEY NOT NULL,
-		name text NOT NULL
-	);`, w.fullTableName()))
+// unmarkDirty undoes markDirty.
+func (w *dbWrapperImpl) unmarkDirty(ctx context.Context, isUp bool, version int, name string) error {
+	if isUp {
+		return w.recordUnapplied(ctx, w.db, version, name)
+	}
+	return w.ResolveDirty(ctx, version, true)
+}
+
+// finishDirty records that an up migration marked dirty has finished.
+func (w *dbWrapperImpl) finishDirty(ctx context.Context, db Querier, version int, appliedAt time.Time, duration time.Duration) error {
+	paramFunc, err := dialectParams(w.dialect)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s
+		   SET dirty = NULL,
+			   applied_at = %s,
+			   duration_ms = %s
+		 WHERE version = %s
+	`, w.fullTableName(), paramFunc(), paramFunc(), paramFunc()),
+		appliedAt.UTC().Format(time.RFC3339), duration.Milliseconds(), version)
 	return err
 }
 
+// ResolveDirty clears a migration's dirty flag, either keeping it as applied
+// or removing it from the version table.
+func (w *dbWrapperImpl) ResolveDirty(ctx context.Context, version int, applied bool) error {
+	paramFunc, err := dialectParams(w.dialect)
+	if err != nil {
+		return err
+	}
+
+	if applied {
+		_, err = w.db.ExecContext(ctx, fmt.Sprintf(`
+			UPDATE %s
+			   SET dirty = NULL
+			 WHERE version = %s
+		`, w.fullTableName(), paramFunc()),
+			version)
+		return err
+	}
+
+	_, err = w.db.ExecContext(ctx, fmt.Sprintf(`
+		DELETE FROM %s
+			  WHERE version = %s
+	`, w.fullTableName(), paramFunc()),
+		version)
+	return err
+}
+
+// executedStatements describes the part of a migration that ran before it
+// failed.
+type executedStatements struct {
+	// False if the migration was run as a whole, so it's unknown how much of
+	// it ran
+	split      bool
+	statements int
+	// Whether any of them were DDL the database committed implicitly
+	committedDDL bool
+}
+
+// partial reports whether a failed migration is known to have left changes
+// behind.
+func (e executedStatements) partial(useTx bool) bool {
+	if useTx {
+		return e.committedDDL
+	}
+	return e.statements > 0
+}
+
+// clean reports whether a failed migration is known to have left nothing
+// behind.
+func (e executedStatements) clean(useTx bool) bool {
+	if !e.split {
+		return false
+	}
+	if useTx {
+		return !e.committedDDL
+	}
+	return e.split && e.statements == 0
+}
+
+// execMigration runs a migration, one statement at a time if the dialect
+// supports it. Errors are *migrateError.
+func (w *dbWrapperImpl) execMigration(ctx context.Context, db Querier, query string) (completed executedStatements, err error) {
+	splitter, ok := w.dialect.(statementSplitter)
+	if !ok {
+		_, err = db.ExecContext(ctx, query)
+		if err != nil {
+			err = &migrateError{cause: err}
+		}
+		return
+	}
+
+	completed.split = true
+	statements := splitter.splitStatements(query)
+	for i, statement := range statements {
+		statementCtx, endStatement := w.startStatement(ctx, &StatementEvent{
+			Statement: i + 1,
+			Total:     len(statements),
+			StartLine: statement.StartLine,
+			EndLine:   statement.EndLine,
+			SQL:       statement.SQL,
+		})
+		_, err = db.ExecContext(statementCtx, statement.SQL)
+		endStatement(err)
+		if err != nil {
+			err = &migrateError{
+				cause:     err,
+				statement: i + 1,
+				total:     len(statements),
+				startLine: statement.StartLine,
+				endLine:   statement.EndLine,
+			}
+			return
+		}
+
+		completed.statements++
+		if !w.dialect.TransactionalDDL() && isDDL(statement.SQL) {
+			completed.committedDDL = true
+		}
+	}
+	return
+}
+
 func (w *dbWrapperImpl) ListMigrations(ctx context.Context) (result []dbMigration, err error) {
 	rows, err := w.db.QueryContext(ctx, fmt.Sprintf(`
-		SELECT version, name
+		SELECT version, name, checksum, applied_at, duration_ms, applied_by, libmigrate_version, dirty
 		  FROM %s
 	  ORDER BY version ASC
 	`, w.fullTableName()))
@@ -103,29 +384,103 @@ func (w *dbWrapperImpl) ListMigrations(ctx context.Context) (result []dbMigratio
 
 	for rows.Next() {
 		var m dbMigration
-		err = rows.Scan(&m.Version, &m.Name)
+		var checksum, appliedAt, appliedBy, libmigrateVersion, dirty sql.NullString
+		var durationMs sql.NullInt64
+		err = rows.Scan(&m.Version, &m.Name, &checksum, &appliedAt, &durationMs, &appliedBy, &libmigrateVersion, &dirty)
 		if err != nil {
 			return
 		}
+		m.Checksum = checksum.String
+		m.Duration = time.Duration(durationMs.Int64) * time.Millisecond
+		m.AppliedBy = appliedBy.String
+		m.LibmigrateVersion = libmigrateVersion.String
+		m.Dirty = dirty.String
+		if appliedAt.Valid {
+			// Unparseable timestamps are left as the zero time; they're
+			// informational only.
+			m.AppliedAt, _ = time.Parse(time.RFC3339, appliedAt.String)
+		}
 
 		result = append(result, m)
 	}
 
+	err = rows.Err()
 	return
 }
 
+func (w *dbWrapperImpl) SetChecksum(ctx context.Context, version int, checksum string) error {
+	paramFunc, err := dialectParams(w.dialect)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.db.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s
+		   SET checksum = %s
+		 WHERE version = %s
+	`, w.fullTableName(), paramFunc(), paramFunc()),
+		checksum, version)
+	return err
+}
+
+// ReadMigrations is ListMigrations without RequireSchema: it reads the
+// version table at whatever layout it has, and returns nothing if it doesn't
+// exist yet. Columns the layout doesn't have are left empty.
+func (w *dbWrapperImpl) ReadMigrations(ctx context.Context) (result []dbMigration, err error) {
+	layout, err := w.readLayout(ctx)
+	if err != nil {
+		return
+	}
+	if layout >= len(metaMigrations) {
+		return w.ListMigrations(ctx)
+	}
+	if w.probe(ctx, "*") != nil {
+		// Nothing has created the version table yet
+		return nil, nil
+	}
+
+	// 2 is the layout that added checksums
+	columns := "version, name"
+	if layout >= 2 {
+		columns += ", checksum"
+	}
+	rows, err := w.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		  FROM %s
+	  ORDER BY version ASC
+	`, columns, w.fullTableName()))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m dbMigration
+		var checksum sql.NullString
+		dest := []interface{}{&m.Version, &m.Name}
+		if layout >= 2 {
+			dest = append(dest, &checksum)
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		m.Checksum = checksum.String
+		result = append(result, m)
+	}
+	return result, rows.Err()
+}
+
+// GetVersion returns the latest applied migration. Dirty migrations aren't
+// counted, since they may have only partly run.
 func (w *dbWrapperImpl) GetVersion(ctx context.Context) (version int, err error) {
 	err = w.db.QueryRowContext(ctx, fmt.Sprintf(`
 		SELECT coalesce(max(version), 0)
 		  FROM %s
+		 WHERE dirty IS NULL
 		  `, w.fullTableName())).Scan(&version)
 	return
 }
 
 func (w *dbWrapperImpl) fullTableName() string {
-	if w.tableSchema != "" {
-		return fmt.Sprintf("%s.\"%s\"", w.tableSchema, w.tableName)
-	}
-
-	return fmt.Sprintf("\"%s\"", w.tableName)
+	return quoteTableName(w.dialect, w.tableSchema, w.tableName)
 }
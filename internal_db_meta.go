@@ -0,0 +1,207 @@
+package libmigrate
+
+import (
+	"context"
+	"fmt"
+)
+
+// The layout of the version table is versioned, so that existing databases
+// can be upgraded in place. Each entry upgrades the layout by one version and
+// must be idempotent: a process may die between applying a step and
+// recording it, and two processes may upgrade the same database at once
+// (RequireSchema runs without the migration lock), so a step must also
+// succeed if another process applied it first.
+//
+// Never edit or reorder these; append a new step instead.
+var metaMigrations = []func(ctx context.Context, w *dbWrapperImpl) error{
+	// 1: the original layout
+	func(ctx context.Context, w *dbWrapperImpl) error {
+		_, err := w.db.ExecContext(ctx, w.dialect.CreateTableSQL(w.fullTableName(), []string{
+			"version integer PRIMARY KEY NOT NULL",
+			"name " + textType(w.dialect, true) + " NOT NULL",
+		}))
+		return err
+	},
+	// 2: checksums
+	func(ctx context.Context, w *dbWrapperImpl) error {
+		return w.requireColumn(ctx, "checksum", textType(w.dialect, false))
+	},
+	// 3: history
+	func(ctx context.Context, w *dbWrapperImpl) error {
+		for _, column := range []struct{ name, columnType string }{
+			{"applied_at", textType(w.dialect, false)},
+			{"duration_ms", "integer"},
+			{"applied_by", textType(w.dialect, false)},
+			{"libmigrate_version", textType(w.dialect, false)},
+		} {
+			if err := w.requireColumn(ctx, column.name, column.columnType); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 4: dirty state, set to "up" or "down" while a migration that can't be
+	// rolled back is running
+	func(ctx context.Context, w *dbWrapperImpl) error {
+		return w.requireColumn(ctx, "dirty", textType(w.dialect, false))
+	},
+}
+
+const (
+	dirtyUp   = "up"
+	dirtyDown = "down"
+)
+
+// RequireSchema creates the version table, or upgrades it if it was created
+// by an older version of libmigrate.
+func (w *dbWrapperImpl) RequireSchema(ctx context.Context) error {
+	schemaVersion, err := w.getSchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	// A newer libmigrate may have upgraded the table past what we know;
+	// its additions are backwards compatible, so leave them be.
+	if schemaVersion >= len(metaMigrations) {
+		return nil
+	}
+
+	for _, metaMigration := range metaMigrations[schemaVersion:] {
+		if err = metaMigration(ctx, w); err != nil {
+			return &schemaUpgradeError{
+				fromVersion: schemaVersion,
+				toVersion:   len(metaMigrations),
+				cause:       err,
+			}
+		}
+	}
+
+	return w.setSchemaVersion(ctx, schemaVersion, len(metaMigrations))
+}
+
+func (w *dbWrapperImpl) fullMetaTableName() string {
+	return quoteTableName(w.dialect, w.tableSchema, w.tableName+"_meta")
+}
+
+// CheckSchema returns a *schemaOutdatedError if the version table needs to
+// be created or upgraded, without changing anything.
+func (w *dbWrapperImpl) CheckSchema(ctx context.Context) error {
+	schemaVersion, err := w.readLayout(ctx)
+	if err != nil {
+		return err
+	}
+
+	if schemaVersion < len(metaMigrations) {
+		return &schemaOutdatedError{
+			version:  schemaVersion,
+			expected: len(metaMigrations),
+		}
+	}
+	return nil
+}
+
+// getSchemaVersion reads the layout version, creating the meta table if it
+// can't be read.
+func (w *dbWrapperImpl) getSchemaVersion(ctx context.Context) (schemaVersion int, err error) {
+	schemaVersion, err = w.readSchemaVersion(ctx)
+	if err == nil {
+		return
+	}
+
+	_, err = w.db.ExecContext(ctx, w.dialect.CreateTableSQL(w.fullMetaTableName(), []string{
+		"schema_version integer NOT NULL",
+	}))
+	if err != nil {
+		return
+	}
+
+	return w.readSchemaVersion(ctx)
+}
+
+// readLayout reads the layout version without creating the meta table. If
+// the meta table doesn't exist, the layout is 0.
+func (w *dbWrapperImpl) readLayout(ctx context.Context) (int, error) {
+	schemaVersion, err := w.readSchemaVersion(ctx)
+	if err == nil {
+		return schemaVersion, nil
+	}
+
+	// Drivers don't agree on an error for a missing table, so if the
+	// database can otherwise be queried, the table is taken to be missing.
+	var one int
+	if pingErr := w.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); pingErr != nil {
+		return 0, pingErr
+	}
+	return 0, nil
+}
+
+func (w *dbWrapperImpl) readSchemaVersion(ctx context.Context) (schemaVersion int, err error) {
+	err = w.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT coalesce(max(schema_version), 0)
+		  FROM %s
+	`, w.fullMetaTableName())).Scan(&schemaVersion)
+	return
+}
+
+func (w *dbWrapperImpl) setSchemaVersion(ctx context.Context, fromVersion, toVersion int) error {
+	paramFunc, err := dialectParams(w.dialect)
+	if err != nil {
+		return err
+	}
+
+	// Two processes upgrading a new database at once may both insert a row;
+	// that's harmless, since it's read with max() and updated as a whole.
+	if fromVersion == 0 {
+		_, err = w.db.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO %s
+						(schema_version)
+				 VALUES (%s)
+		`, w.fullMetaTableName(), paramFunc()),
+			toVersion)
+		return err
+	}
+
+	_, err = w.db.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s
+		   SET schema_version = %s
+	`, w.fullMetaTableName(), paramFunc()),
+		toVersion)
+	return err
+}
+
+// requireColumn adds a column to the version table, unless it's already
+// there.
+func (w *dbWrapperImpl) requireColumn(ctx context.Context, column, columnType string) error {
+	if w.probe(ctx, column) == nil {
+		return nil
+	}
+	// Drivers don't agree on an error for a missing column, so check that
+	// the table itself can be read; if not, the problem is something else,
+	// like the connection or permissions.
+	if err := w.probe(ctx, "*"); err != nil {
+		return err
+	}
+
+	_, err := w.db.ExecContext(ctx, fmt.Sprintf(`
+		ALTER TABLE %s
+				ADD %s %s
+	`, w.fullTableName(), column, columnType))
+	if err != nil && w.probe(ctx, column) == nil {
+		// Another process added it first
+		return nil
+	}
+	return err
+}
+
+// probe selects columns from the version table, without reading any rows.
+func (w *dbWrapperImpl) probe(ctx context.Context, columns string) error {
+	rows, err := w.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		  FROM %s
+		 WHERE 1 = 0
+	`, columns, w.fullTableName()))
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
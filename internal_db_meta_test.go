@@ -0,0 +1,258 @@
+package libmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func metaFixture(t *testing.T, schemaVersion int) (*fakeDB, *dbWrapperImpl) {
+	f, db := newFakeDB(t)
+	f.onRows(`^SELECT coalesce\(max\(schema_version\), 0\)`,
+		[]string{"schema_version"}, []driver.Value{int64(schemaVersion)})
+	return f, &dbWrapperImpl{
+		db:        db,
+		dialect:   ParamTypeQuestionMark,
+		tableName: "migration_version",
+	}
+}
+
+func TestRequireSchemaNewDatabase(t *testing.T) {
+	f, w := metaFixture(t, 0)
+	f.onError(`^SELECT \w+ FROM "migration_version" WHERE 1 = 0$`, errors.New("no such column"))
+
+	err := w.RequireSchema(context.Background())
+	require.NoError(t, err)
+	require.Len(t, f.matching(`^CREATE TABLE IF NOT EXISTS "migration_version" `), 1)
+	require.Equal(t, []string{
+		`ALTER TABLE "migration_version" ADD checksum text`,
+		`ALTER TABLE "migration_version" ADD applied_at text`,
+		`ALTER TABLE "migration_version" ADD duration_ms integer`,
+		`ALTER TABLE "migration_version" ADD applied_by text`,
+		`ALTER TABLE "migration_version" ADD libmigrate_version text`,
+		`ALTER TABLE "migration_version" ADD dirty text`,
+	}, f.matching(`^ALTER TABLE`))
+	require.Equal(t, []string{
+		`INSERT INTO "migration_version_meta" (schema_version) VALUES (?)`,
+	}, f.matching(`migration_version_meta" \(schema_version\)|^UPDATE`))
+}
+
+func TestRequireSchemaUpgrade(t *testing.T) {
+	f, w := metaFixture(t, 2)
+	f.onError(`^SELECT \w+ FROM "migration_version" WHERE 1 = 0$`, errors.New("no such column"))
+
+	err := w.RequireSchema(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, f.matching(`^CREATE TABLE IF NOT EXISTS "migration_version" `))
+	require.Empty(t, f.matching(`ADD checksum`))
+	require.Len(t, f.matching(`^ALTER TABLE`), 5)
+	require.Equal(t, []string{
+		`UPDATE "migration_version_meta" SET schema_version = ?`,
+	}, f.matching(`^UPDATE`))
+}
+
+func TestRequireSchemaIdempotent(t *testing.T) {
+	// The columns already exist, e.g. a previous upgrade died before it was
+	// recorded.
+	f, w := metaFixture(t, 1)
+
+	err := w.RequireSchema(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, f.matching(`^ALTER TABLE`))
+	require.Len(t, f.matching(`^UPDATE`), 1)
+}
+
+func TestRequireSchemaCurrent(t *testing.T) {
+	f, w := metaFixture(t, len(metaMigrations))
+
+	err := w.RequireSchema(context.Background())
+	require.NoError(t, err)
+	require.Len(t, f.queries, 1)
+}
+
+func TestRequireSchemaNewer(t *testing.T) {
+	f, w := metaFixture(t, len(metaMigrations)+1)
+
+	err := w.RequireSchema(context.Background())
+	require.NoError(t, err)
+	require.Len(t, f.queries, 1)
+}
+
+func TestRequireSchemaCreatesMetaTable(t *testing.T) {
+	f, db := newFakeDB(t)
+	reads := 0
+	f.on(`^SELECT coalesce\(max\(schema_version\), 0\)`, func([]driver.Value) fakeResult {
+		reads++
+		if reads == 1 {
+			return fakeResult{err: errors.New("no such table")}
+		}
+		return fakeResult{columns: []string{"schema_version"}, rows: [][]driver.Value{{int64(len(metaMigrations))}}}
+	})
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   ParamTypeQuestionMark,
+		tableName: "migration_version",
+	}
+
+	err := w.RequireSchema(context.Background())
+	require.NoError(t, err)
+	require.Len(t, f.matching(`^CREATE TABLE IF NOT EXISTS "migration_version_meta"`), 1)
+	require.Equal(t, 2, reads)
+}
+
+func TestRequireColumnConcurrentUpgrade(t *testing.T) {
+	f, w := metaFixture(t, 3)
+	probes := 0
+	f.on(`^SELECT dirty FROM`, func([]driver.Value) fakeResult {
+		probes++
+		if probes == 1 {
+			return fakeResult{err: errors.New("no such column")}
+		}
+		return fakeResult{columns: []string{"dirty"}}
+	})
+	f.onError(`^ALTER TABLE`, errors.New("duplicate column name: dirty"))
+
+	err := w.RequireSchema(context.Background())
+	require.NoError(t, err)
+	require.Len(t, f.matching(`^ALTER TABLE`), 1)
+	require.Len(t, f.matching(`^UPDATE`), 1)
+}
+
+func TestRequireColumnProbeError(t *testing.T) {
+	f, w := metaFixture(t, 3)
+	cause := errors.New("connection reset")
+	f.onError(`FROM "migration_version" WHERE 1 = 0$`, cause)
+
+	err := w.RequireSchema(context.Background())
+	require.Equal(t, &schemaUpgradeError{
+		fromVersion: 3,
+		toVersion:   len(metaMigrations),
+		cause:       cause,
+	}, err)
+	require.Empty(t, f.matching(`^ALTER TABLE`))
+}
+
+func TestRequireSchemaError(t *testing.T) {
+	f, w := metaFixture(t, 1)
+	cause := errors.New("permission denied")
+	f.onError(`^SELECT checksum FROM`, errors.New("no such column"))
+	f.onError(`^ALTER TABLE`, cause)
+
+	err := w.RequireSchema(context.Background())
+	require.Equal(t, &schemaUpgradeError{
+		fromVersion: 1,
+		toVersion:   len(metaMigrations),
+		cause:       cause,
+	}, err)
+	require.Empty(t, f.matching(`^UPDATE`))
+}
+
+func TestCheckSchema(t *testing.T) {
+	f, w := metaFixture(t, len(metaMigrations))
+
+	err := w.CheckSchema(context.Background())
+	require.NoError(t, err)
+	require.Len(t, f.queries, 1)
+
+	f, w = metaFixture(t, 2)
+	err = w.CheckSchema(context.Background())
+	require.Equal(t, &schemaOutdatedError{version: 2, expected: len(metaMigrations)}, err)
+	require.Empty(t, f.matching(`^CREATE|^ALTER|^INSERT|^UPDATE`))
+}
+
+func TestCheckSchemaNewDatabase(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.onError(`_meta"$`, errors.New("no such table"))
+	f.onRows(`^SELECT 1$`, []string{"1"}, []driver.Value{int64(1)})
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   SQLiteDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.CheckSchema(context.Background())
+	require.Equal(t, &schemaOutdatedError{version: 0, expected: len(metaMigrations)}, err)
+	require.Empty(t, f.matching(`^CREATE|^ALTER|^INSERT|^UPDATE`))
+
+}
+
+func TestCheckSchemaConnectionError(t *testing.T) {
+	f, db := newFakeDB(t)
+	cause := errors.New("connection refused")
+	f.onError(`.`, cause)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   SQLiteDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.CheckSchema(context.Background())
+	require.Equal(t, cause, err)
+}
+
+func TestRequireSchemaSQLServerTypes(t *testing.T) {
+	f, w := metaFixture(t, 0)
+	w.dialect = SQLServerDialect{}
+	f.onError(`^SELECT \w+ FROM \[migration_version\] WHERE 1 = 0$`, errors.New("Invalid column name"))
+
+	err := w.RequireSchema(context.Background())
+	require.NoError(t, err)
+	created := f.matching(`^IF OBJECT_ID\(N'\[migration_version\]', N'U'\) IS NULL CREATE TABLE`)
+	require.Len(t, created, 1)
+	require.Contains(t, created[0], "name nvarchar(255) NOT NULL")
+	require.Equal(t, []string{
+		`ALTER TABLE [migration_version] ADD checksum nvarchar(max)`,
+		`ALTER TABLE [migration_version] ADD applied_at nvarchar(max)`,
+		`ALTER TABLE [migration_version] ADD duration_ms integer`,
+		`ALTER TABLE [migration_version] ADD applied_by nvarchar(max)`,
+		`ALTER TABLE [migration_version] ADD libmigrate_version nvarchar(max)`,
+		`ALTER TABLE [migration_version] ADD dirty nvarchar(max)`,
+	}, f.matching(`^ALTER TABLE`))
+	require.Empty(t, f.matching(` text\b`))
+}
+
+func TestReadMigrationsNewDatabase(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.onError(`_meta"$`, errors.New("no such table"))
+	f.onError(`^SELECT \* FROM "migration_version"`, errors.New("no such table"))
+	f.onRows(`^SELECT 1$`, []string{"1"}, []driver.Value{int64(1)})
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   SQLiteDialect{},
+		tableName: "migration_version",
+	}
+
+	migrations, err := w.ReadMigrations(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, migrations)
+	require.Empty(t, f.matching(`^CREATE|^ALTER|^INSERT|^UPDATE`))
+}
+
+func TestReadMigrationsOldLayout(t *testing.T) {
+	f, w := metaFixture(t, 2)
+	f.onRows(`^SELECT version, name, checksum FROM "migration_version" ORDER BY`,
+		[]string{"version", "name", "checksum"},
+		[]driver.Value{int64(1), "first", "abc"})
+
+	migrations, err := w.ReadMigrations(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []dbMigration{{Version: 1, Name: "first", Checksum: "abc"}}, migrations)
+	require.Empty(t, f.matching(`^CREATE|^ALTER|^INSERT|^UPDATE`))
+}
+
+func TestReadMigrationsConnectionError(t *testing.T) {
+	f, db := newFakeDB(t)
+	cause := errors.New("connection refused")
+	f.onError(`.`, cause)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   SQLiteDialect{},
+		tableName: "migration_version",
+	}
+
+	_, err := w.ReadMigrations(context.Background())
+	require.Equal(t, cause, err)
+}
@@ -1,6 +1,12 @@
 package libmigrate
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
 
 func TestFullTableName(t *testing.T) {
 	cases := []struct {
@@ -21,6 +27,7 @@ func TestFullTableName(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.expected, func(t *testing.T) {
 			db := &dbWrapperImpl{
+				dialect:     ParamTypeDollarSign,
 				tableSchema: c.schema,
 				tableName:   c.table,
 			}
@@ -31,3 +38,69 @@ func TestFullTableName(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyMigrationStatementError(t *testing.T) {
+	f, db := newFakeDB(t)
+	cause := errors.New("syntax error")
+	f.onError(`^INSERT INTO b`, cause)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   PostgresDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.ApplyMigration(context.Background(), true, true, 1, "first",
+		"CREATE TABLE b (id int);\n\nINSERT INTO b\n\tVALUES (1);\nSELECT 1;\n", "")
+	require.Equal(t, &migrateError{
+		cause:     cause,
+		statement: 2,
+		total:     3,
+		startLine: 3,
+		endLine:   4,
+	}, err)
+	require.Equal(t, "running migration: statement 2 of 3 (lines 3-4): syntax error", err.Error())
+	require.Equal(t, []string{
+		"BEGIN",
+		"CREATE TABLE b (id int);",
+		"INSERT INTO b VALUES (1);",
+		"ROLLBACK",
+	}, f.queries)
+}
+
+func TestApplyMigrationUnsplit(t *testing.T) {
+	f, db := newFakeDB(t)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   ParamTypeDollarSign,
+		tableName: "migration_version",
+	}
+
+	err := w.ApplyMigration(context.Background(), false, false, 1, "first",
+		"DROP TABLE b; DROP TABLE c;", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`UPDATE "migration_version" SET dirty = $1 WHERE version = $2`,
+		"DROP TABLE b; DROP TABLE c;",
+		`DELETE FROM "migration_version" WHERE version = $1 AND name = $2`,
+	}, f.queries)
+}
+
+func TestMarkMigrations(t *testing.T) {
+	f, db := newFakeDB(t)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   PostgresDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.MarkMigrations(context.Background(),
+		[]dbMigration{{Version: 1, Name: "first", Checksum: "abc"}},
+		[]dbMigration{{Version: 2, Name: "old"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"BEGIN",
+		`DELETE FROM "migration_version" WHERE version = $1 AND name = $2`,
+		`INSERT INTO "migration_version" (version, name, checksum, applied_at, duration_ms, applied_by, libmigrate_version) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		"COMMIT",
+	}, f.queries)
+}
@@ -18,9 +18,67 @@ const NoTransactionPrefix = "-- migrate: no-transaction\n"
 type Migrator interface {
 	MigrateLatest(ctx context.Context) error
 	MigrateTo(ctx context.Context, version int) error
+	// Apply the next n migrations.
+	Up(ctx context.Context, n int) error
+	// Roll back the last n migrations.
+	Down(ctx context.Context, n int) error
+	// Roll back the latest migration, then apply it again.
+	Redo(ctx context.Context) error
+	// The latest applied migration. A dirty migration (see Resolve) isn't
+	// counted.
 	GetVersion(ctx context.Context) (int, error)
 	HasPending(ctx context.Context) (bool, error)
+	// Report the current and latest versions, pending migrations and any
+	// dirty migration, without writing to the database. See
+	// NewHealthHandler.
+	Health(ctx context.Context) (*HealthStatus, error)
 	Create(ctx context.Context, name string) error
+	// Record the current checksum of every applied up migration, accepting
+	// any edits made to them since they were applied.
+	RepairChecksums(ctx context.Context) error
+	// List the applied migrations, oldest first.
+	History(ctx context.Context) ([]AppliedMigration, error)
+	// Clear the dirty state left by a failed migration that couldn't be
+	// rolled back (see DirtyError), after repairing the database by hand. If
+	// applied is true, the migration is kept in the version table as applied;
+	// otherwise it's removed.
+	Resolve(ctx context.Context, applied bool) error
+	// Register a migration written in Go. It's merged with the migration
+	// files, and no file may share its version.
+	AddGoMigration(migration GoMigration)
+	// List the migrations MigrateTo would run to reach version, in order,
+	// without running them. Like a dry run, this doesn't create or upgrade
+	// the version table.
+	Plan(ctx context.Context, version int) ([]PlanStep, error)
+	// Write a SQL script that migrates a database from one version to
+	// another, as MigrateTo would, including the version table updates. It
+	// reads only the migration files, not the database. Scripts starting
+	// from version 0 create the version table. The script must stop at its
+	// first error; for psql and sqlite3 it sets this itself.
+	WriteScript(w io.Writer, fromVersion, toVersion int) error
+	// Plan the migrations to reach version, with the database's current
+	// version and each file's checksum, for ApplyPlan to run later. Like
+	// Plan, this doesn't create or upgrade the version table.
+	CreatePlan(ctx context.Context, version int) (*PlanFile, error)
+	// Run exactly the migrations in plan. If the database's version or any
+	// of the planned migrations has changed since it was created, nothing
+	// runs. With SetDryRun, the plan is checked and printed but not run.
+	ApplyPlan(ctx context.Context, plan *PlanFile) error
+	// List every migration on the filesystem or in the database, with
+	// whether it's applied.
+	Status(ctx context.Context) ([]MigrationStatus, error)
+	// Record migrations 1 to version as applied, without running them, for a
+	// database whose schema was built some other way. It fails if any
+	// migrations are already recorded.
+	Baseline(ctx context.Context, version int) error
+	// Like Baseline, but first removes any migrations already recorded.
+	ForceBaseline(ctx context.Context, version int) error
+	// Record the next migration as applied, without running it, e.g. after
+	// applying it by hand.
+	MarkApplied(ctx context.Context, version int) error
+	// Remove the latest migration from the version table, without running
+	// its down migration.
+	MarkUnapplied(ctx context.Context, version int) error
 
 	SetTableName(name string)
 	// If set, "table" becomes schema."table"
@@ -28,11 +86,50 @@ type Migrator interface {
 
 	// Set to nil to disable output. Default: os.Stdout
 	SetOutputWriter(io.Writer)
+	// Receives structured events, replacing the output writer. Set to nil
+	// to disable output. Default: NewWriterLogger(os.Stdout)
+	SetLogger(logger Logger)
+
+	// If set, MigrateTo and MigrateLatest hold this lock while they run, so
+	// that concurrent processes don't apply the same migrations. Set to nil
+	// to disable locking. Default: the Dialect's Locker
+	SetLocker(locker Locker)
+	// How long to wait for the lock before failing with ErrLockTimeout. Zero
+	// waits until the context is done. Default: DefaultLockTimeout
+	SetLockTimeout(timeout time.Duration)
+	// If false, edits to already-applied up migrations aren't reported as a
+	// ChecksumMismatchError. Default: true
+	SetVerifyChecksums(verify bool)
+	// Recorded with each migration applied, e.g. a deploy ID or username.
+	// Default: ""
+	SetAppliedBy(appliedBy string)
+	// For databases that commit DDL implicitly (like MySQL), migrations that
+	// mix DDL with other statements can't be rolled back as a unit. If true,
+	// they're refused unless marked with NoTransactionPrefix; otherwise they
+	// only print a warning. Default: false
+	SetRequireAtomicMigrations(require bool)
+	// If true, MigrateTo and MigrateLatest (and Up, Down and Redo) check and
+	// print the migrations they would run, without running them. They don't
+	// take the lock or create or upgrade the version table. Default: false
+	SetDryRun(dryRun bool)
+	// Whether MigrateTo runs all of its migrations in one transaction.
+	// Default: BatchNone
+	SetBatchMode(mode BatchMode)
+	// Code to run around migrations. Default: none
+	SetHooks(hooks Hooks)
+	// Adds an Observer that is sent each Event. Default: none
+	AddObserver(observer Observer)
+	// Wraps runs, migrations and statements, e.g. in tracing spans.
+	// Default: none
+	SetTracer(tracer Tracer)
 }
 
 // Different databases use different syntax for indicating parameter values.
 // Since jmoiron/sqlx hasn't found a better way than naming each one, we
 // probably won't either. Leave it to the caller.
+//
+// Deprecated: ParamType is a Dialect with ANSI quoting and no lock. Use
+// PostgresDialect, SQLiteDialect or MySQLDialect instead.
 type ParamType int
 
 const (
@@ -48,29 +145,31 @@ type DB interface {
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
-func New(db DB, migrationDir string, paramType ParamType) Migrator {
-	return internalNew(db, os.DirFS(migrationDir), migrationDir, paramType)
+func New(db DB, migrationDir string, dialect Dialect) Migrator {
+	return internalNew(db, os.DirFS(migrationDir), migrationDir, dialect)
 }
 
-func NewFs(db DB, fs fs.FS, paramType ParamType) Migrator {
-	return internalNew(db, fs, "", paramType)
+func NewFs(db DB, fs fs.FS, dialect Dialect) Migrator {
+	return internalNew(db, fs, "", dialect)
 }
 
 // Only pass migrationDir if it's intended to be writeable
-func internalNew(db DB, fs fs.FS, migrationDir string, paramType ParamType) *migrator {
+func internalNew(db DB, fs fs.FS, migrationDir string, dialect Dialect) *migrator {
 	return &migrator{
+		dialect: dialect,
 		db: &dbWrapperImpl{
 			db:          db,
 			tableSchema: "",
 			tableName:   "migration_version",
-			paramType:   paramType,
+			dialect:     dialect,
 		},
 		filesystem: &filesystemWrapperImpl{
 			migrationDir: migrationDir,
 			fsys:         fs,
 		},
 		disableTransactions: false,
-		outputWriter:        os.Stdout,
+		logger:              NewWriterLogger(os.Stdout),
+		lockTimeout:         DefaultLockTimeout,
 	}
 }
 
@@ -82,12 +181,33 @@ func (m *migrator) SetTableSchema(schema string) {
 	m.db.SetTableSchema(schema)
 }
 
-func (m *migrator) SetOutputWriter(writer io.Writer) {
-	m.outputWriter = writer
+func (m *migrator) SetLocker(locker Locker) {
+	m.db.SetLocker(locker)
+}
+
+func (m *migrator) SetLockTimeout(timeout time.Duration) {
+	m.lockTimeout = timeout
+}
+
+func (m *migrator) SetVerifyChecksums(verify bool) {
+	m.skipChecksums = !verify
+}
+
+func (m *migrator) SetRequireAtomicMigrations(require bool) {
+	m.requireAtomic = require
 }
 
 func (m *migrator) MigrateLatest(ctx context.Context) (err error) {
-	migrations, err := m.listMigrations(ctx)
+	ctx, run, err := m.beginRun(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		m.finishRun(ctx, run, err)
+	}()
+
+	// Checksum problems are reported by migrateTo, with any others
+	migrations, _, err := m.listMigrationsDeferred(ctx)
 	if err != nil {
 		return
 	}
@@ -97,67 +217,175 @@ func (m *migrator) MigrateLatest(ctx context.Context) (err error) {
 		toVersion = migrations[len(migrations)-1].Version
 	}
 
-	return m.MigrateTo(ctx, toVersion)
+	return m.migrateTo(ctx, run, toVersion)
 }
 
 func (m *migrator) MigrateTo(ctx context.Context, version int) (err error) {
-	availableMigrations, err := m.listMigrations(ctx)
+	ctx, run, err := m.beginRun(ctx)
 	if err != nil {
 		return
 	}
+	defer func() {
+		m.finishRun(ctx, run, err)
+	}()
+
+	return m.migrateTo(ctx, run, version)
+}
 
-	currVersion, err := m.GetVersion(ctx)
+func (m *migrator) Up(ctx context.Context, n int) error {
+	if n < 0 {
+		return negativeStepsError(n)
+	}
+	return m.migrateBy(ctx, n)
+}
+
+func (m *migrator) Down(ctx context.Context, n int) error {
+	if n < 0 {
+		return negativeStepsError(n)
+	}
+	return m.migrateBy(ctx, -n)
+}
+
+func negativeStepsError(n int) error {
+	return &badVersionError{
+		version: n,
+		problem: "the number of migrations can't be negative",
+	}
+}
+
+// migrateBy migrates up (or, if step is negative, down) by that many
+// versions.
+func (m *migrator) migrateBy(ctx context.Context, step int) (err error) {
+	ctx, run, err := m.beginRun(ctx)
 	if err != nil {
 		return
 	}
-	m.printf("Migrating from %d to %d\n", currVersion, version)
-	start := time.Now()
 	defer func() {
-		if err == nil {
-			m.printf("Finished in %v\n", time.Since(start))
-		}
+		m.finishRun(ctx, run, err)
 	}()
-	if version == currVersion {
-		return nil
+
+	currVersion, err := m.currentVersion(ctx)
+	if err != nil {
+		return
 	}
 
-	if version < 0 {
-		return &badVersionError{
-			version: version,
-			problem: "version must be 0 or higher",
-		}
+	return m.migrateTo(ctx, run, currVersion+step)
+}
+
+func (m *migrator) Redo(ctx context.Context) (err error) {
+	ctx, run, err := m.beginRun(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		m.finishRun(ctx, run, err)
+	}()
+
+	availableMigrations, problems, err := m.listMigrationsDeferred(ctx)
+	if err != nil {
+		return
+	}
+
+	err = m.requireClean(ctx)
+	if err != nil {
+		return
 	}
 
-	if version > len(availableMigrations) {
+	currVersion, err := m.currentVersion(ctx)
+	if err != nil {
+		return
+	}
+	if currVersion == 0 {
 		return &badVersionError{
-			version: version,
-			problem: fmt.Sprintf("max version is %d", len(availableMigrations)),
+			version: currVersion,
+			problem: "no migration has been applied",
 		}
 	}
+	run.event.FromVersion, run.event.ToVersion = currVersion, currVersion
+	m.log(ctx, LogEvent{
+		Message:     fmt.Sprintf("Redoing version %d", currVersion),
+		FromVersion: currVersion,
+		ToVersion:   currVersion,
+	})
+
+	// Both directions are checked before the down migration runs, so a bad
+	// up migration can't leave the database a version behind.
+	path := []migration{availableMigrations[currVersion-1], availableMigrations[currVersion-1]}
+	down, downProblems := m.validatePath(path[:1], false)
+	up, upProblems := m.validatePath(path[1:], true)
+	problems = append(problems, downProblems...)
+	problems = append(problems, upProblems...)
+
+	return m.runPath(ctx, run, path, append(down, up...), problems)
+}
 
-	isUp := currVersion < version
-	step := 1
-	if !isUp {
-		step = -1
+// migrateTo expects the caller to hold the migration lock.
+func (m *migrator) migrateTo(ctx context.Context, run *runState, version int) (err error) {
+	availableMigrations, problems, err := m.listMigrationsDeferred(ctx)
+	if err != nil {
+		return
 	}
 
-	for currVersion != version {
-		var migration migration
-		if isUp {
-			migration = availableMigrations[currVersion]
-		} else {
-			migration = availableMigrations[currVersion-1]
+	err = m.requireClean(ctx)
+	if err != nil {
+		return
+	}
+
+	currVersion, err := m.currentVersion(ctx)
+	if err != nil {
+		return
+	}
+	run.event.FromVersion, run.event.ToVersion = currVersion, version
+	m.log(ctx, LogEvent{
+		Message:     fmt.Sprintf("Migrating from %d to %d", currVersion, version),
+		FromVersion: currVersion,
+		ToVersion:   version,
+	})
+
+	path, isUp, err := migrationPath(availableMigrations, currVersion, version)
+	if err != nil {
+		return
+	}
+
+	// Check the whole path before changing anything, so a problem part way
+	// through doesn't leave the database at an unexpected version.
+	steps, pathProblems := m.validatePath(path, isUp)
+	problems = append(problems, pathProblems...)
+	return m.runPath(ctx, run, path, steps, problems)
+}
+
+// runPath runs the steps planned for path, or prints them for a dry run.
+// If any problems were found planning them, nothing runs.
+func (m *migrator) runPath(ctx context.Context, run *runState, path []migration, steps []PlanStep, problems []error) (err error) {
+	if m.batchMode == BatchRequired && len(steps) > 1 {
+		if problem := m.batchProblem(steps); problem != nil {
+			problems = append(problems, problem)
 		}
+	}
+	err = newValidationError(problems)
+	if err != nil {
+		return
+	}
 
-		err = m.internalMigrate(ctx, migration, isUp)
-		if err != nil {
-			return
+	start := time.Now()
+	defer func() {
+		if err == nil {
+			m.log(ctx, LogEvent{
+				Message:     fmt.Sprintf("Finished in %v", time.Since(start)),
+				FromVersion: run.event.FromVersion,
+				ToVersion:   run.event.ToVersion,
+				Duration:    time.Since(start),
+			})
 		}
+	}()
 
-		currVersion += step
+	if m.dryRun {
+		m.logf(ctx, "Dry run: nothing will be changed")
+		m.printPlan(ctx, steps)
+		return nil
 	}
 
-	return nil
+	return m.applySteps(ctx, run, path, steps)
 }
 
 func (m *migrator) GetVersion(ctx context.Context) (int, error) {
@@ -205,12 +433,116 @@ func (m *migrator) Create(ctx context.Context, name string) (err error) {
 
 	path, err := m.filesystem.CreateFile(next, name, "up")
 	if err == nil {
-		m.printf(" Created %s\n", path)
+		m.logCreated(ctx, next, name, path)
 		path, err = m.filesystem.CreateFile(next, name, "down")
 		if err == nil {
-			m.printf(" Created %s\n", path)
+			m.logCreated(ctx, next, name, path)
 		}
 	}
 
 	return
 }
+
+func (m *migrator) logCreated(ctx context.Context, version int, name, path string) {
+	m.log(ctx, LogEvent{
+		Message: fmt.Sprintf("Created %s", path),
+		Version: version,
+		Name:    name,
+	})
+}
+
+func (m *migrator) RepairChecksums(ctx context.Context) (err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	err = m.db.RequireSchema(ctx)
+	if err != nil {
+		return
+	}
+
+	names, err := m.filesystem.ListMigrationDir()
+	if err != nil {
+		return
+	}
+	migrations, err := parseMigrationFilenames(names, m.goMigrations)
+	if err != nil {
+		return
+	}
+
+	dbMigrations, err := m.db.ListMigrations(ctx)
+	if err != nil {
+		return
+	}
+	err = matchDbMigrations(dbMigrations, migrations)
+	if err != nil {
+		return
+	}
+
+	for _, dbMigration := range dbMigrations {
+		migration := migrations[dbMigration.Version]
+		if migration.Go != nil {
+			continue
+		}
+
+		var sqlString string
+		sqlString, err = m.filesystem.ReadMigration(migration.Filename(true))
+		if err != nil {
+			return
+		}
+
+		sum := checksum(sqlString)
+		if sum == dbMigration.Checksum {
+			continue
+		}
+
+		err = m.db.SetChecksum(ctx, dbMigration.Version, sum)
+		if err != nil {
+			return
+		}
+		m.log(ctx, LogEvent{
+			Message: fmt.Sprintf("Updated checksum for %s", migration.Filename(true)),
+			Version: migration.Version,
+			Name:    migration.Name,
+		})
+	}
+
+	return nil
+}
+
+func (m *migrator) Resolve(ctx context.Context, applied bool) (err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	err = m.db.RequireSchema(ctx)
+	if err != nil {
+		return
+	}
+
+	dirty, err := m.findDirty(ctx)
+	if err != nil {
+		return
+	}
+	if dirty == nil {
+		return &notDirtyError{}
+	}
+
+	err = m.db.ResolveDirty(ctx, dirty.Version, applied)
+	if err == nil {
+		state := "not applied"
+		if applied {
+			state = "applied"
+		}
+		m.log(ctx, LogEvent{
+			Message: fmt.Sprintf("Resolved %d (%s) as %s", dirty.Version, dirty.Name, state),
+			Version: dirty.Version,
+			Name:    dirty.Name,
+		})
+	}
+	return
+}
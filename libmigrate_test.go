@@ -121,7 +121,7 @@ func TestMigrateLatest(t *testing.T) {
 		calledGetVersion = true
 		return dbVersion, nil
 	}
-	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query string) error {
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
 		require.True(t, isUp)
 		require.Equal(t, dbVersion+1, version)
 		require.Equal(t, fmt.Sprintf("v%d", version), name)
@@ -159,7 +159,7 @@ func TestMigrateToUp(t *testing.T) {
 		calledGetVersion = true
 		return 1, nil
 	}
-	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query string) error {
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
 		require.True(t, isUp)
 		require.Equal(t, 2, version)
 		require.Equal(t, fmt.Sprintf("v%d", version), name)
@@ -178,7 +178,7 @@ func TestMigrateToDown(t *testing.T) {
 		calledGetVersion = true
 		return 1, nil
 	}
-	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query string) error {
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
 		require.False(t, isUp)
 		require.Equal(t, 1, version)
 		require.Equal(t, fmt.Sprintf("v%d", version), name)
@@ -206,13 +206,9 @@ func TestMigrateToDownMissing(t *testing.T) {
 		return 2, nil
 	}
 
-	// Should call apply once (at version 2), then error
-	applyCalled := false
-	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query string) error {
-		applyCalled = true
-		require.False(t, isUp)
-		require.Equal(t, 2, version)
-		require.Equal(t, fmt.Sprintf("v%d", version), name)
+	// The whole path is checked first, so nothing is applied
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		t.Fatal("applied a migration before finding the missing one")
 		return nil
 	}
 
@@ -221,7 +217,6 @@ func TestMigrateToDownMissing(t *testing.T) {
 		isUp:    false,
 		version: 1,
 	}, err)
-	require.True(t, applyCalled)
 }
 
 func TestHasPendingTrue(t *testing.T) {
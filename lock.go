@@ -0,0 +1,299 @@
+package libmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DefaultLockTimeout is how long a Migrator waits for another process to
+// release the migration lock before giving up.
+const DefaultLockTimeout = 5 * time.Minute
+
+// Lock acquisition is retried with a backoff between these two bounds.
+const (
+	minLockRetryInterval = 50 * time.Millisecond
+	maxLockRetryInterval = time.Second
+)
+
+// A Locker keeps more than one process from running migrations against the
+// same database at once.
+//
+// TryLock makes a single attempt to take the lock. If another process holds
+// it, TryLock returns acquired == false and the Migrator retries until the
+// lock timeout expires. On success, the returned unlock function releases
+// the lock.
+type Locker interface {
+	TryLock(ctx context.Context, db DB) (unlock func(context.Context) error, acquired bool, err error)
+}
+
+// *sql.DB implements this; holding a dedicated connection is the only safe
+// way to take a session-level lock from a connection pool.
+type connProvider interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// *sql.DB implements this too. A session lock can't share a pool limited to
+// one connection with the migrations it protects.
+type statsProvider interface {
+	Stats() sql.DBStats
+}
+
+type lockSession interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// openLockSession pins a single connection for the lifetime of a lock. If
+// db can't hand out a connection, an open transaction serves the same
+// purpose.
+func openLockSession(ctx context.Context, db DB) (session lockSession, closeSession func() error, err error) {
+	if p, ok := db.(connProvider); ok {
+		var conn *sql.Conn
+		conn, err = p.Conn(ctx)
+		if err != nil {
+			return
+		}
+		return conn, conn.Close, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	return tx, tx.Rollback, nil
+}
+
+// NewPostgresLocker returns a Locker using a PostgreSQL session-level
+// advisory lock (pg_try_advisory_lock) with the given key.
+func NewPostgresLocker(key int64) Locker {
+	return &sessionLocker{
+		lockQuery:   "SELECT pg_try_advisory_lock($1)",
+		unlockQuery: "SELECT pg_advisory_unlock($1)",
+		arg:         key,
+	}
+}
+
+// NewMySQLLocker returns a Locker using a MySQL/MariaDB named lock
+// (GET_LOCK) with the given name.
+func NewMySQLLocker(name string) Locker {
+	return &sessionLocker{
+		lockQuery:   "SELECT coalesce(GET_LOCK(?, 0), 0)",
+		unlockQuery: "SELECT RELEASE_LOCK(?)",
+		arg:         name,
+	}
+}
+
+// NewSQLServerLocker returns a Locker using a SQL Server session-owned
+// application lock (sp_getapplock) on the given resource.
+func NewSQLServerLocker(resource string) Locker {
+	return &sessionLocker{
+		lockQuery: `
+			DECLARE @result int;
+			EXEC @result = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0;
+			SELECT CASE WHEN @result >= 0 THEN 1 ELSE 0 END;`,
+		unlockQuery: `
+			DECLARE @result int;
+			EXEC @result = sp_releaseapplock @Resource = @p1, @LockOwner = 'Session';
+			SELECT CASE WHEN @result >= 0 THEN 1 ELSE 0 END;`,
+		arg: resource,
+	}
+}
+
+// sessionLocker takes a lock that belongs to a database session, so it
+// holds one connection until the lock is released. It refuses to run on a
+// *sql.DB limited to one open connection (SetMaxOpenConns(1)).
+type sessionLocker struct {
+	lockQuery   string
+	unlockQuery string
+	arg         interface{}
+}
+
+func (l *sessionLocker) TryLock(ctx context.Context, db DB) (unlock func(context.Context) error, acquired bool, err error) {
+	// Holding the only connection would leave the migrations waiting for it
+	// forever.
+	if p, ok := db.(statsProvider); ok && p.Stats().MaxOpenConnections == 1 {
+		return nil, false, &singleConnectionError{}
+	}
+
+	session, closeSession, err := openLockSession(ctx, db)
+	if err != nil {
+		return
+	}
+
+	err = session.QueryRowContext(ctx, l.lockQuery, l.arg).Scan(&acquired)
+	if err != nil || !acquired {
+		closeSession()
+		return nil, false, err
+	}
+
+	unlock = func(ctx context.Context) error {
+		var released bool
+		err := session.QueryRowContext(ctx, l.unlockQuery, l.arg).Scan(&released)
+		if closeErr := closeSession(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	return unlock, true, nil
+}
+
+// NewTableLocker returns a Locker for databases without a native named lock
+// (like SQLite). The lock is a single row in its own table, which is created
+// if needed. If schema is set, the table is schema."table".
+//
+// If a process dies while holding the lock, the row stays behind and every
+// later run waits for it until the lock timeout. Once you're sure no
+// migration is running, break the lock with:
+//
+//	DELETE FROM migration_version_lock WHERE id = 1
+func NewTableLocker(schema, table string) Locker {
+	return &tableLocker{
+		tableName: quoteTableName(SQLiteDialect{}, schema, table),
+	}
+}
+
+type tableLocker struct {
+	tableName string
+}
+
+func (l *tableLocker) TryLock(ctx context.Context, db DB) (unlock func(context.Context) error, acquired bool, err error) {
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		id integer PRIMARY KEY NOT NULL
+	);`, l.tableName))
+	if err != nil {
+		return
+	}
+
+	_, insertErr := db.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (id) VALUES (1)
+	`, l.tableName))
+	if insertErr != nil {
+		// The insert fails on the primary key if someone else holds the
+		// lock; any other failure is a real error.
+		var held int
+		err = db.QueryRowContext(ctx, fmt.Sprintf(`
+			SELECT count(*)
+			  FROM %s
+			 WHERE id = 1
+		`, l.tableName)).Scan(&held)
+		if err == nil && held == 0 {
+			err = insertErr
+		}
+		return nil, false, err
+	}
+
+	unlock = func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, fmt.Sprintf(`
+			DELETE FROM %s
+				  WHERE id = 1
+		`, l.tableName))
+		return err
+	}
+	return unlock, true, nil
+}
+
+// A runState follows a command that migrates the database (MigrateTo,
+// MigrateLatest, Up, Down, Redo or ApplyPlan) from beginRun to finishRun.
+type runState struct {
+	// The run's versions and migration count, filled in as they're known
+	event   RunStartedEvent
+	start   time.Time
+	locked  bool
+	unlock  func()
+	endSpan func(err error)
+}
+
+// beginRun takes the lock for a command that respects SetDryRun: dry runs
+// change nothing, so they don't take it. The run's trace span starts first,
+// so waiting for the lock shows up in it. The command must call finishRun
+// with its result, and run with the returned context.
+func (m *migrator) beginRun(ctx context.Context) (context.Context, *runState, error) {
+	run := &runState{
+		start:   time.Now(),
+		unlock:  func() {},
+		endSpan: endNothing,
+	}
+	if m.dryRun {
+		return ctx, run, nil
+	}
+
+	ctx, run.endSpan = m.startRun(ctx, &run.event)
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		run.endSpan(err)
+		return ctx, nil, err
+	}
+	run.locked = true
+	run.unlock = unlock
+	return ctx, run, nil
+}
+
+// finishRun releases the lock. Observers are sent a RunFinishedEvent for
+// every run that took it, including runs that failed before any migration
+// ran.
+func (m *migrator) finishRun(ctx context.Context, run *runState, err error) {
+	if run.locked {
+		m.notify(ctx, &RunFinishedEvent{
+			FromVersion: run.event.FromVersion,
+			ToVersion:   run.event.ToVersion,
+			Duration:    time.Since(run.start),
+			Err:         err,
+		})
+	}
+	run.unlock()
+	run.endSpan(err)
+}
+
+// lock blocks until the migration lock is held, the lock timeout passes, or
+// ctx is done. The returned function releases the lock.
+func (m *migrator) lock(ctx context.Context) (unlock func(), err error) {
+	var deadline <-chan time.Time
+	if m.lockTimeout > 0 {
+		timer := time.NewTimer(m.lockTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	start := time.Now()
+	interval := minLockRetryInterval
+	for {
+		release, acquired, err := m.db.TryLock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			m.notify(ctx, &LockAcquiredEvent{Wait: time.Since(start)})
+			return func() {
+				// Use a fresh context so a cancelled run still releases
+				// the lock.
+				if err := release(context.Background()); err != nil {
+					m.log(context.Background(), LogEvent{
+						Level:   LogError,
+						Message: fmt.Sprintf("Failed to release migration lock: %v", err),
+						Err:     err,
+					})
+				}
+			}, nil
+		}
+
+		if interval == minLockRetryInterval {
+			m.logf(ctx, "Waiting for migration lock")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, &lockTimeoutError{timeout: m.lockTimeout}
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > maxLockRetryInterval {
+			interval = maxLockRetryInterval
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package libmigrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockRetriesUntilAcquired(t *testing.T) {
+	m, db, _ := Fixture(t)
+	attempts := 0
+	released := false
+	db.tryLock = func(ctx context.Context) (func(context.Context) error, bool, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, false, nil
+		}
+		return func(context.Context) error {
+			released = true
+			return nil
+		}, true, nil
+	}
+
+	unlock, err := m.lock(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.False(t, released)
+
+	unlock()
+	require.True(t, released)
+}
+
+func TestLockTimeout(t *testing.T) {
+	m, db, _ := Fixture(t)
+	m.lockTimeout = 10 * time.Millisecond
+	db.tryLock = func(ctx context.Context) (func(context.Context) error, bool, error) {
+		return nil, false, nil
+	}
+
+	_, err := m.lock(context.Background())
+	require.Equal(t, &lockTimeoutError{timeout: 10 * time.Millisecond}, err)
+	require.True(t, errors.Is(err, ErrLockTimeout))
+}
+
+func TestLockError(t *testing.T) {
+	m, db, _ := Fixture(t)
+	lockErr := errors.New("lock failed")
+	db.tryLock = func(ctx context.Context) (func(context.Context) error, bool, error) {
+		return nil, false, lockErr
+	}
+
+	err := m.MigrateTo(context.Background(), 1)
+	require.Equal(t, lockErr, err)
+}
+
+func TestMigrateToHoldsLock(t *testing.T) {
+	m, db, _ := Fixture(t)
+	locked := false
+	db.tryLock = func(ctx context.Context) (func(context.Context) error, bool, error) {
+		require.False(t, locked)
+		locked = true
+		return func(context.Context) error {
+			locked = false
+			return nil
+		}, true, nil
+	}
+	db.getVersion = func(ctx context.Context) (int, error) {
+		return 0, nil
+	}
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		require.True(t, locked)
+		return nil
+	}
+
+	err := m.MigrateLatest(context.Background())
+	require.NoError(t, err)
+	require.False(t, locked)
+}
+
+func TestSessionLocker(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.onRows(`^SELECT pg_try_advisory_lock`, []string{"locked"}, []driver.Value{true})
+	f.onRows(`^SELECT pg_advisory_unlock`, []string{"unlocked"}, []driver.Value{true})
+
+	unlock, acquired, err := NewPostgresLocker(42).TryLock(context.Background(), db)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.Equal(t, []string{"SELECT pg_try_advisory_lock($1)"}, f.queries)
+
+	err = unlock(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"SELECT pg_try_advisory_lock($1)",
+		"SELECT pg_advisory_unlock($1)",
+	}, f.queries)
+}
+
+func TestSessionLockerHeld(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.onRows(`^SELECT coalesce\(GET_LOCK`, []string{"locked"}, []driver.Value{int64(0)})
+
+	unlock, acquired, err := NewMySQLLocker("libmigrate").TryLock(context.Background(), db)
+	require.NoError(t, err)
+	require.False(t, acquired)
+	require.Nil(t, unlock)
+	require.Empty(t, f.matching(`RELEASE_LOCK`))
+}
+
+func TestSessionLockerSingleConnection(t *testing.T) {
+	f, db := newFakeDB(t)
+	db.SetMaxOpenConns(1)
+
+	_, acquired, err := NewSQLServerLocker("libmigrate").TryLock(context.Background(), db)
+	require.Equal(t, &singleConnectionError{}, err)
+	require.False(t, acquired)
+	require.Empty(t, f.queries)
+
+	// Without the check, the run would wait forever for the connection the
+	// lock holds.
+	m := NewFs(db, fstest.MapFS{
+		"0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+		"0001_a.down.sql": {Data: []byte("SELECT 1;")},
+	}, PostgresDialect{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = m.MigrateLatest(ctx)
+	require.Equal(t, &singleConnectionError{}, err)
+}
+
+func TestTableLocker(t *testing.T) {
+	f, db := newFakeDB(t)
+	locker := NewTableLocker("", "migration_version_lock")
+
+	unlock, acquired, err := locker.TryLock(context.Background(), db)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "migration_version_lock" ( id integer PRIMARY KEY NOT NULL );`,
+		`INSERT INTO "migration_version_lock" (id) VALUES (1)`,
+	}, f.queries)
+
+	err = unlock(context.Background())
+	require.NoError(t, err)
+	require.Len(t, f.matching(`^DELETE FROM "migration_version_lock" WHERE id = 1$`), 1)
+}
+
+func TestTableLockerHeld(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.onError(`^INSERT`, errors.New("UNIQUE constraint failed"))
+	f.onRows(`^SELECT count\(\*\)`, []string{"count"}, []driver.Value{int64(1)})
+
+	unlock, acquired, err := NewTableLocker("", "migration_version_lock").TryLock(context.Background(), db)
+	require.NoError(t, err)
+	require.False(t, acquired)
+	require.Nil(t, unlock)
+	require.Empty(t, f.matching(`^DELETE`))
+}
+
+func TestTableLockerInsertError(t *testing.T) {
+	f, db := newFakeDB(t)
+	cause := errors.New("attempt to write a readonly database")
+	f.onError(`^INSERT`, cause)
+	f.onRows(`^SELECT count\(\*\)`, []string{"count"}, []driver.Value{int64(0)})
+
+	_, acquired, err := NewTableLocker("", "migration_version_lock").TryLock(context.Background(), db)
+	require.Equal(t, cause, err)
+	require.False(t, acquired)
+}
@@ -0,0 +1,170 @@
+package libmigrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A LogLevel is how important a LogEvent is.
+type LogLevel int
+
+const (
+	// Detail that NewWriterLogger leaves out, like each migration finishing
+	LogDebug LogLevel = iota - 1
+	LogInfo
+	LogWarn
+	LogError
+)
+
+// Transaction modes of a LogEvent.
+const (
+	TransactionNone   = "none"
+	TransactionSingle = "transaction"
+	TransactionBatch  = "batch"
+)
+
+// A LogEvent is something a Migrator reports as it works. Fields that don't
+// apply to the event are left zero.
+type LogEvent struct {
+	Level LogLevel
+	// Human readable, e.g. "+ 0003_add_users.up.sql"
+	Message string
+
+	// For events about a single migration
+	Version   int
+	Name      string
+	Direction string // "up" or "down"
+	// TransactionNone, TransactionSingle or TransactionBatch, for
+	// migrations that are starting
+	Transaction string
+
+	// For events about a run
+	FromVersion int
+	ToVersion   int
+
+	// For events that finish something
+	Duration time.Duration
+	Err      error
+}
+
+// A Logger receives a Migrator's LogEvents. See NewWriterLogger, and
+// NewSlogLogger for log/slog.
+type Logger interface {
+	Log(ctx context.Context, event LogEvent)
+}
+
+// NewWriterLogger returns a Logger that writes each event's message to w, as
+// human readable lines.
+func NewWriterLogger(w io.Writer) Logger {
+	return &writerLogger{w: w}
+}
+
+type writerLogger struct {
+	w io.Writer
+}
+
+func (l *writerLogger) Log(ctx context.Context, event LogEvent) {
+	indent := ""
+	if event.Version != 0 {
+		indent = " "
+	}
+
+	switch event.Level {
+	case LogDebug:
+		return
+	case LogWarn:
+		fmt.Fprintf(l.w, "   Warning: %s\n", event.Message)
+	case LogError:
+		fmt.Fprintf(l.w, "   Error: %s\n", event.Message)
+	default:
+		fmt.Fprintf(l.w, "%s%s\n", indent, event.Message)
+	}
+}
+
+func (m *migrator) SetLogger(logger Logger) {
+	m.logger = logger
+}
+
+func (m *migrator) SetOutputWriter(writer io.Writer) {
+	if writer == nil {
+		m.logger = nil
+		return
+	}
+	m.logger = NewWriterLogger(writer)
+}
+
+func (m *migrator) log(ctx context.Context, event LogEvent) {
+	if m.logger == nil {
+		return
+	}
+
+	m.logger.Log(ctx, event)
+}
+
+// logf logs an informational message with no other fields.
+func (m *migrator) logf(ctx context.Context, format string, a ...interface{}) {
+	m.log(ctx, LogEvent{Message: fmt.Sprintf(format, a...)})
+}
+
+// stepEvent starts an event about a planned migration.
+func stepEvent(step PlanStep, level LogLevel, message string) LogEvent {
+	return LogEvent{
+		Level:     level,
+		Message:   message,
+		Version:   step.Version,
+		Name:      step.Name,
+		Direction: direction(step.IsUp),
+	}
+}
+
+func direction(isUp bool) string {
+	if isUp {
+		return "up"
+	}
+	return "down"
+}
+
+// stepStarted tells the logger and observers that a migration is about to
+// run.
+func (m *migrator) stepStarted(ctx context.Context, step PlanStep, transaction string) {
+	event := stepEvent(step, LogInfo, fmt.Sprintf("%s %s", stepNote(step.IsUp), step.Filename))
+	event.Transaction = transaction
+	m.log(ctx, event)
+	m.notify(ctx, &MigrationStartedEvent{
+		Version:     step.Version,
+		Name:        step.Name,
+		IsUp:        step.IsUp,
+		Transaction: transaction,
+	})
+}
+
+// stepFinished tells the logger and observers how a migration went.
+func (m *migrator) stepFinished(ctx context.Context, step PlanStep, duration time.Duration, err error) {
+	m.notifyMigration(ctx, step, duration, err)
+
+	event := stepEvent(step, LogDebug, fmt.Sprintf("Finished %s in %v", step.Filename, duration))
+	if err != nil {
+		event.Level = LogError
+		event.Message = fmt.Sprintf("%s failed: %v", step.Filename, err)
+	}
+	event.Duration = duration
+	event.Err = err
+	m.log(ctx, event)
+}
+
+func transactionMode(useTx bool) string {
+	if useTx {
+		return TransactionSingle
+	}
+	return TransactionNone
+}
+
+// stepNote marks a migration as applied or rolled back in messages.
+func stepNote(isUp bool) string {
+	if isUp {
+		return "+"
+	}
+	return "-"
+}
@@ -0,0 +1,108 @@
+package libmigrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordLogger struct {
+	events []LogEvent
+}
+
+func (l *recordLogger) Log(ctx context.Context, event LogEvent) {
+	l.events = append(l.events, event)
+}
+
+func TestLoggerEvents(t *testing.T) {
+	m, db, _ := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	cause := errors.New("failed")
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		if version == 2 {
+			return cause
+		}
+		return nil
+	}
+	logger := &recordLogger{}
+	m.SetLogger(logger)
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.Equal(t, cause, err)
+
+	require.Len(t, logger.events, 5)
+	require.Equal(t, LogEvent{
+		Message:   "Migrating from 0 to 2",
+		ToVersion: 2,
+	}, logger.events[0])
+	require.Equal(t, LogEvent{
+		Message:     "+ 0001_v1.up.sql",
+		Version:     1,
+		Name:        "v1",
+		Direction:   "up",
+		Transaction: TransactionSingle,
+	}, logger.events[1])
+	require.Equal(t, LogDebug, logger.events[2].Level)
+	require.Equal(t, 1, logger.events[2].Version)
+	require.Nil(t, logger.events[2].Err)
+
+	failed := logger.events[4]
+	require.Equal(t, LogError, failed.Level)
+	require.Equal(t, 2, failed.Version)
+	require.Equal(t, "up", failed.Direction)
+	require.Equal(t, cause, failed.Err)
+}
+
+func TestWriterLogger(t *testing.T) {
+	m, db, _ := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		return nil
+	}
+	var buf bytes.Buffer
+	m.SetOutputWriter(&buf)
+
+	err := m.MigrateTo(context.Background(), 1)
+	require.NoError(t, err)
+
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	require.Len(t, lines, 4)
+	require.Equal(t, "Migrating from 0 to 1", string(lines[0]))
+	require.Equal(t, " + 0001_v1.up.sql", string(lines[1]))
+	require.Contains(t, string(lines[2]), "Finished in ")
+	require.Equal(t, "", string(lines[3]))
+
+	buf.Reset()
+	NewWriterLogger(&buf).Log(context.Background(), LogEvent{Level: LogWarn, Message: "careful"})
+	require.Equal(t, "   Warning: careful\n", buf.String())
+
+	m.SetOutputWriter(nil)
+	require.Nil(t, m.logger)
+}
+
+func TestWriterLoggerIndents(t *testing.T) {
+	m, db, fs := Fixture(t)
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{{Version: 1, Name: "other"}}, nil
+	}
+	db.markMigrations = func(ctx context.Context, a, u []dbMigration) error { return nil }
+	fs.createFile = func(version int, name, direction string) (string, error) {
+		return fmt.Sprintf("%04d_%s.%s.sql", version, name, direction), nil
+	}
+	var buf bytes.Buffer
+	m.SetOutputWriter(&buf)
+
+	err := m.ForceBaseline(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, " Baselined at version 2, removing 1 recorded migration(s)\n", buf.String())
+
+	buf.Reset()
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) { return nil, nil }
+	err = m.Create(context.Background(), "new")
+	require.NoError(t, err)
+	require.Equal(t, " Created 0004_new.up.sql\n Created 0004_new.down.sql\n", buf.String())
+}
@@ -0,0 +1,80 @@
+package libmigrate
+
+import (
+	"context"
+	"fmt"
+)
+
+func (m *migrator) MarkApplied(ctx context.Context, version int) error {
+	return m.mark(ctx, version, true)
+}
+
+func (m *migrator) MarkUnapplied(ctx context.Context, version int) error {
+	return m.mark(ctx, version, false)
+}
+
+func (m *migrator) mark(ctx context.Context, version int, applied bool) (err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	availableMigrations, err := m.listMigrations(ctx)
+	if err != nil {
+		return
+	}
+
+	err = m.requireClean(ctx)
+	if err != nil {
+		return
+	}
+
+	currVersion, err := m.GetVersion(ctx)
+	if err != nil {
+		return
+	}
+
+	// Migrations are applied in order, so only the next one can be marked
+	// applied, and only the latest unapplied.
+	expected := currVersion
+	if applied {
+		expected = currVersion + 1
+	}
+	if version != expected || version < 1 || version > len(availableMigrations) {
+		return &badVersionError{
+			version: version,
+			problem: fmt.Sprintf("the database is at version %d", currVersion),
+		}
+	}
+
+	migration := availableMigrations[version-1]
+	record := dbMigration{
+		Version: migration.Version,
+		Name:    migration.Name,
+	}
+
+	if applied {
+		record.Checksum, err = m.upChecksum(migration)
+		if err != nil {
+			return
+		}
+		err = m.db.MarkMigrations(ctx, []dbMigration{record}, nil)
+	} else {
+		err = m.db.MarkMigrations(ctx, nil, []dbMigration{record})
+	}
+	if err != nil {
+		return
+	}
+
+	state := "not applied"
+	if applied {
+		state = "applied"
+	}
+	m.log(ctx, LogEvent{
+		Message: fmt.Sprintf("Marked %s as %s", migration.label(true), state),
+		Version: migration.Version,
+		Name:    migration.Name,
+	})
+	return nil
+}
@@ -0,0 +1,56 @@
+package libmigrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func markFixture(t *testing.T) (*migrator, *dbMock, *[]dbMigration, *[]dbMigration) {
+	m, db, fs := Fixture(t)
+	fs.readMigration = func(name string) (string, error) { return "-- " + name, nil }
+	db.getVersion = func(ctx context.Context) (int, error) { return 1, nil }
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{{Version: 1, Name: "v1"}}, nil
+	}
+	var applied, unapplied []dbMigration
+	db.markMigrations = func(ctx context.Context, a, u []dbMigration) error {
+		applied, unapplied = a, u
+		return nil
+	}
+	return m, db, &applied, &unapplied
+}
+
+func TestMarkApplied(t *testing.T) {
+	m, _, applied, unapplied := markFixture(t)
+
+	err := m.MarkApplied(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, []dbMigration{
+		{Version: 2, Name: "v2", Checksum: checksum("-- 0002_v2.up.sql")},
+	}, *applied)
+	require.Empty(t, *unapplied)
+}
+
+func TestMarkUnapplied(t *testing.T) {
+	m, _, applied, unapplied := markFixture(t)
+
+	err := m.MarkUnapplied(context.Background(), 1)
+	require.NoError(t, err)
+	require.Empty(t, *applied)
+	require.Equal(t, []dbMigration{{Version: 1, Name: "v1"}}, *unapplied)
+}
+
+func TestMarkOutOfOrder(t *testing.T) {
+	m, _, _, _ := markFixture(t)
+
+	err := m.MarkApplied(context.Background(), 3)
+	require.Equal(t, &badVersionError{
+		version: 3,
+		problem: "the database is at version 1",
+	}, err)
+
+	err = m.MarkUnapplied(context.Background(), 2)
+	require.IsType(t, &badVersionError{}, err)
+}
@@ -0,0 +1,114 @@
+package libmigrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const mixedMigration = "ALTER TABLE a ADD b int;\nUPDATE a SET b = 1;\n"
+
+func mysqlFixture(t *testing.T, sql string) (*migrator, *dbMock) {
+	m, db, fs := Fixture(t)
+	m.dialect = MySQLDialect{}
+	db.getVersion = func(ctx context.Context) (int, error) {
+		return 0, nil
+	}
+	fs.readMigration = func(name string) (string, error) {
+		return sql, nil
+	}
+	return m, db
+}
+
+func TestNonAtomicMigrationWarns(t *testing.T) {
+	m, db := mysqlFixture(t, mixedMigration)
+	applied := false
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		applied = true
+		return nil
+	}
+
+	err := m.MigrateTo(context.Background(), 1)
+	require.NoError(t, err)
+	require.True(t, applied)
+}
+
+func TestNonAtomicMigrationRefused(t *testing.T) {
+	m, _ := mysqlFixture(t, mixedMigration)
+	m.SetRequireAtomicMigrations(true)
+
+	err := m.MigrateTo(context.Background(), 1)
+	require.Equal(t, &nonAtomicMigrationError{
+		version: 1,
+		name:    "v1",
+		isUp:    true,
+	}, err)
+}
+
+func TestNonAtomicMigrationAllowedWithoutTransaction(t *testing.T) {
+	m, db := mysqlFixture(t, NoTransactionPrefix+mixedMigration)
+	m.SetRequireAtomicMigrations(true)
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		require.False(t, useTx)
+		return nil
+	}
+
+	err := m.MigrateTo(context.Background(), 1)
+	require.NoError(t, err)
+}
+
+func TestMySQLPartialMigration(t *testing.T) {
+	f, db := newFakeDB(t)
+	cause := errors.New("unknown column")
+	f.onError(`^UPDATE a`, cause)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   MySQLDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.ApplyMigration(context.Background(), true, true, 3, "mixed", mixedMigration, "")
+	require.Equal(t, &partialMigrationError{
+		version:   3,
+		name:      "mixed",
+		isUp:      true,
+		completed: 1,
+		cause: &migrateError{
+			cause:     cause,
+			statement: 2,
+			total:     2,
+			startLine: 2,
+			endLine:   2,
+		},
+	}, err)
+	require.Equal(t, []string{
+		"INSERT INTO `migration_version` (version, name, checksum, applied_by, libmigrate_version, dirty) VALUES (?, ?, ?, ?, ?, ?)",
+		"BEGIN",
+		"ALTER TABLE a ADD b int;",
+		"UPDATE a SET b = 1;",
+		"ROLLBACK",
+	}, f.queries)
+}
+
+func TestMySQLFailureWithoutDDLRollsBack(t *testing.T) {
+	f, db := newFakeDB(t)
+	cause := errors.New("duplicate key")
+	f.onError(`^INSERT INTO a`, cause)
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   MySQLDialect{},
+		tableName: "migration_version",
+	}
+
+	err := w.ApplyMigration(context.Background(), true, true, 3, "dml",
+		"UPDATE a SET b = 1; INSERT INTO a VALUES (1);", "")
+	require.Equal(t, &migrateError{
+		cause:     cause,
+		statement: 2,
+		total:     2,
+		startLine: 1,
+		endLine:   1,
+	}, err)
+}
@@ -0,0 +1,122 @@
+package libmigrate
+
+import (
+	"context"
+	"time"
+)
+
+// An Observer follows a Migrator's progress, e.g. to update a deploy UI.
+// Observe receives one of the *Event types below; switch on its type to pick
+// the ones you need. Observers are called in the order they were added, and
+// shouldn't block.
+type Observer interface {
+	Observe(ctx context.Context, event Event)
+}
+
+// ObserverFunc lets a function be used as an Observer.
+type ObserverFunc func(ctx context.Context, event Event)
+
+func (f ObserverFunc) Observe(ctx context.Context, event Event) {
+	f(ctx, event)
+}
+
+// An Event is one of RunStartedEvent, LockAcquiredEvent,
+// MigrationStartedEvent, MigrationFinishedEvent, MigrationFailedEvent or
+// RunFinishedEvent.
+type Event interface {
+	event()
+}
+
+// RunStartedEvent is sent before MigrateTo (or MigrateLatest, Up, Down, Redo
+// and ApplyPlan) applies its first migration.
+type RunStartedEvent struct {
+	FromVersion int
+	ToVersion   int
+	Migrations  int
+}
+
+// LockAcquiredEvent is sent when the migration lock is taken.
+type LockAcquiredEvent struct {
+	// How long it took to get the lock
+	Wait time.Duration
+}
+
+// MigrationStartedEvent is sent before each migration runs. In a batch (see
+// SetBatchMode), it's sent as each migration starts within the transaction.
+type MigrationStartedEvent struct {
+	Version int
+	Name    string
+	IsUp    bool
+	// TransactionNone, TransactionSingle or TransactionBatch
+	Transaction string
+}
+
+// MigrationFinishedEvent is sent after a migration is applied or rolled back.
+// In a batch, it's sent for every migration once the transaction commits.
+type MigrationFinishedEvent struct {
+	Version  int
+	Name     string
+	IsUp     bool
+	Duration time.Duration
+}
+
+// MigrationFailedEvent is sent when a migration fails. In a batch, it's sent
+// for every migration that started once the transaction is rolled back, with
+// the error that stopped the batch.
+type MigrationFailedEvent struct {
+	Version  int
+	Name     string
+	IsUp     bool
+	Duration time.Duration
+	Err      error
+}
+
+// RunFinishedEvent is sent after every run that took the lock, whether or
+// not it succeeded: including runs that stopped before applying anything,
+// e.g. with a DirtyError or a validation error, for which no RunStartedEvent
+// was sent. Dry runs don't send it.
+type RunFinishedEvent struct {
+	// Zero if the run failed before they were known
+	FromVersion int
+	ToVersion   int
+	// Including the wait for the lock
+	Duration time.Duration
+	Err      error
+}
+
+func (*RunStartedEvent) event()        {}
+func (*LockAcquiredEvent) event()      {}
+func (*MigrationStartedEvent) event()  {}
+func (*MigrationFinishedEvent) event() {}
+func (*MigrationFailedEvent) event()   {}
+func (*RunFinishedEvent) event()       {}
+
+func (m *migrator) AddObserver(observer Observer) {
+	m.observers = append(m.observers, observer)
+}
+
+func (m *migrator) notify(ctx context.Context, event Event) {
+	for _, observer := range m.observers {
+		observer.Observe(ctx, event)
+	}
+}
+
+func (m *migrator) notifyMigration(ctx context.Context, step PlanStep, duration time.Duration, err error) {
+	if err != nil {
+		m.notify(ctx, &MigrationFailedEvent{
+			Version:  step.Version,
+			Name:     step.Name,
+			IsUp:     step.IsUp,
+			Duration: duration,
+			Err:      err,
+		})
+		return
+	}
+
+	m.notify(ctx, &MigrationFinishedEvent{
+		Version:  step.Version,
+		Name:     step.Name,
+		IsUp:     step.IsUp,
+		Duration: duration,
+	})
+}
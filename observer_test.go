@@ -0,0 +1,140 @@
+package libmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordObserver describes each event it's sent.
+func recordObserver(calls *[]string) Observer {
+	return ObserverFunc(func(ctx context.Context, event Event) {
+		switch e := event.(type) {
+		case *RunStartedEvent:
+			*calls = append(*calls, fmt.Sprintf("run started %d-%d (%d)", e.FromVersion, e.ToVersion, e.Migrations))
+		case *LockAcquiredEvent:
+			*calls = append(*calls, "lock acquired")
+		case *MigrationStartedEvent:
+			*calls = append(*calls, fmt.Sprintf("started %d %s", e.Version, e.Transaction))
+		case *MigrationFinishedEvent:
+			*calls = append(*calls, fmt.Sprintf("finished %d", e.Version))
+		case *MigrationFailedEvent:
+			*calls = append(*calls, fmt.Sprintf("failed %d %v", e.Version, e.Err))
+		case *RunFinishedEvent:
+			*calls = append(*calls, fmt.Sprintf("run finished %v", e.Err))
+		}
+	})
+}
+
+func TestObservers(t *testing.T) {
+	m, db, _ := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	cause := errors.New("failed")
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		if version == 2 {
+			return cause
+		}
+		return nil
+	}
+	var first, second []string
+	m.AddObserver(recordObserver(&first))
+	m.AddObserver(recordObserver(&second))
+
+	err := m.MigrateTo(context.Background(), 3)
+	require.Equal(t, cause, err)
+	require.Equal(t, []string{
+		"lock acquired",
+		"run started 0-3 (3)",
+		"started 1 transaction",
+		"finished 1",
+		"started 2 transaction",
+		"failed 2 failed",
+		"run finished failed",
+	}, first)
+	require.Equal(t, first, second)
+}
+
+func TestObserversBatch(t *testing.T) {
+	m, db, _ := Fixture(t)
+	m.SetBatchMode(BatchRequired)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	var calls []string
+	db.applyBatch = func(ctx context.Context, migrations []batchMigration) error {
+		for _, migration := range migrations {
+			migrationCtx, err := migration.Before(ctx)
+			require.NoError(t, err)
+			migration.After(migrationCtx, 0, nil)
+		}
+		calls = append(calls, "commit")
+		return nil
+	}
+	m.AddObserver(recordObserver(&calls))
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"lock acquired",
+		"run started 0-2 (2)",
+		"started 1 batch",
+		"started 2 batch",
+		"commit",
+		"finished 1",
+		"finished 2",
+		"run finished <nil>",
+	}, calls)
+}
+
+func TestObserversBatchRollback(t *testing.T) {
+	m, db, _ := Fixture(t)
+	m.SetBatchMode(BatchRequired)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	cause := errors.New("failed")
+	db.applyBatch = func(ctx context.Context, migrations []batchMigration) error {
+		migrationCtx, err := migrations[0].Before(ctx)
+		require.NoError(t, err)
+		migrations[0].After(migrationCtx, 0, nil)
+		migrationCtx, err = migrations[1].Before(ctx)
+		require.NoError(t, err)
+		migrations[1].After(migrationCtx, 0, cause)
+		return cause
+	}
+	var calls []string
+	m.AddObserver(recordObserver(&calls))
+
+	err := m.MigrateTo(context.Background(), 3)
+	require.Equal(t, cause, err)
+	require.Equal(t, []string{
+		"lock acquired",
+		"run started 0-3 (3)",
+		"started 1 batch",
+		"started 2 batch",
+		"failed 1 failed",
+		"failed 2 failed",
+		"run finished failed",
+	}, calls)
+}
+
+func TestObserversRunFailsBeforeApplying(t *testing.T) {
+	m, db, _ := Fixture(t)
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{{Version: 1, Name: "v1", Dirty: dirtyUp}}, nil
+	}
+	var calls []string
+	m.AddObserver(recordObserver(&calls))
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.IsType(t, &DirtyError{}, err)
+	require.Equal(t, []string{
+		"lock acquired",
+		fmt.Sprintf("run finished %v", err),
+	}, calls)
+
+	calls = nil
+	m.SetDryRun(true)
+	err = m.MigrateTo(context.Background(), 2)
+	require.IsType(t, &DirtyError{}, err)
+	require.Empty(t, calls)
+}
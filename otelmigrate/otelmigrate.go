@@ -0,0 +1,121 @@
+// Package otelmigrate traces libmigrate runs with OpenTelemetry.
+//
+//	migrator.SetTracer(otelmigrate.NewTracer(nil))
+//
+// Each run gets a span, from before it waits for the migration lock, with a
+// child span for each migration, and for each statement of a migration if
+// the dialect splits them.
+package otelmigrate
+
+import (
+	"context"
+
+	"github.com/ojrac/libmigrate"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/ojrac/libmigrate/otelmigrate"
+
+// Span attribute keys.
+const (
+	FromVersionKey    = attribute.Key("libmigrate.from_version")
+	ToVersionKey      = attribute.Key("libmigrate.to_version")
+	MigrationsKey     = attribute.Key("libmigrate.migrations")
+	VersionKey        = attribute.Key("libmigrate.version")
+	NameKey           = attribute.Key("libmigrate.name")
+	DirectionKey      = attribute.Key("libmigrate.direction")
+	TransactionKey    = attribute.Key("libmigrate.transaction")
+	StatementKey      = attribute.Key("libmigrate.statement")
+	StatementTotalKey = attribute.Key("libmigrate.statement_total")
+	StartLineKey      = attribute.Key("libmigrate.start_line")
+	EndLineKey        = attribute.Key("libmigrate.end_line")
+	QueryTextKey      = attribute.Key("db.query.text")
+)
+
+// An Option configures a Tracer returned by NewTracer.
+type Option func(*tracer)
+
+// WithQueryText records each statement's SQL as the db.query.text attribute
+// of its span. It's off by default, since migrations can contain data that
+// shouldn't leave the application, and large ones make large spans.
+func WithQueryText() Option {
+	return func(t *tracer) {
+		t.queryText = true
+	}
+}
+
+// NewTracer returns a libmigrate.Tracer that creates spans with provider.
+// If provider is nil, the global TracerProvider is used.
+func NewTracer(provider trace.TracerProvider, options ...Option) libmigrate.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	t := &tracer{tracer: provider.Tracer(instrumentationName)}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+type tracer struct {
+	tracer    trace.Tracer
+	queryText bool
+}
+
+func (t *tracer) StartRun(ctx context.Context, run *libmigrate.RunStartedEvent) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, "libmigrate.run")
+	return ctx, func(err error) {
+		// The span starts before the lock is taken, so the versions are
+		// only known now.
+		span.SetAttributes(
+			FromVersionKey.Int(run.FromVersion),
+			ToVersionKey.Int(run.ToVersion),
+			MigrationsKey.Int(run.Migrations),
+		)
+		end(span, err)
+	}
+}
+
+func (t *tracer) StartMigration(ctx context.Context, migration *libmigrate.MigrationStartedEvent) (context.Context, func(err error)) {
+	direction := "down"
+	if migration.IsUp {
+		direction = "up"
+	}
+	return t.start(ctx, "libmigrate.migration",
+		VersionKey.Int(migration.Version),
+		NameKey.String(migration.Name),
+		DirectionKey.String(direction),
+		TransactionKey.String(migration.Transaction),
+	)
+}
+
+func (t *tracer) StartStatement(ctx context.Context, statement *libmigrate.StatementEvent) (context.Context, func(err error)) {
+	attrs := []attribute.KeyValue{
+		StatementKey.Int(statement.Statement),
+		StatementTotalKey.Int(statement.Total),
+		StartLineKey.Int(statement.StartLine),
+		EndLineKey.Int(statement.EndLine),
+	}
+	if t.queryText {
+		attrs = append(attrs, QueryTextKey.String(statement.SQL))
+	}
+	return t.start(ctx, "libmigrate.statement", attrs...)
+}
+
+func (t *tracer) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		end(span, err)
+	}
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,122 @@
+package otelmigrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ojrac/libmigrate"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := NewTracer(provider)
+
+	event := &libmigrate.RunStartedEvent{}
+	ctx, endRun := tracer.StartRun(context.Background(), event)
+	// libmigrate fills the run in once it holds the lock
+	*event = libmigrate.RunStartedEvent{
+		FromVersion: 0,
+		ToVersion:   1,
+		Migrations:  1,
+	}
+	ctx, endMigration := tracer.StartMigration(ctx, &libmigrate.MigrationStartedEvent{
+		Version:     1,
+		Name:        "add_users",
+		IsUp:        true,
+		Transaction: libmigrate.TransactionSingle,
+	})
+	_, endStatement := tracer.StartStatement(ctx, &libmigrate.StatementEvent{
+		Statement: 1,
+		Total:     1,
+		StartLine: 1,
+		EndLine:   1,
+		SQL:       "CREATE TABLE users (id int)",
+	})
+	cause := errors.New("syntax error")
+	endStatement(cause)
+	endMigration(cause)
+	endRun(cause)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	statement, migration, run := spans[0], spans[1], spans[2]
+
+	require.Equal(t, "libmigrate.run", run.Name)
+	require.False(t, run.Parent.IsValid())
+	require.Equal(t, []attribute.KeyValue{
+		FromVersionKey.Int(0),
+		ToVersionKey.Int(1),
+		MigrationsKey.Int(1),
+	}, run.Attributes)
+
+	require.Equal(t, "libmigrate.migration", migration.Name)
+	require.Equal(t, run.SpanContext.SpanID(), migration.Parent.SpanID())
+	require.Equal(t, []attribute.KeyValue{
+		VersionKey.Int(1),
+		NameKey.String("add_users"),
+		DirectionKey.String("up"),
+		TransactionKey.String("transaction"),
+	}, migration.Attributes)
+
+	require.Equal(t, "libmigrate.statement", statement.Name)
+	require.Equal(t, migration.SpanContext.SpanID(), statement.Parent.SpanID())
+	require.Equal(t, []attribute.KeyValue{
+		StatementKey.Int(1),
+		StatementTotalKey.Int(1),
+		StartLineKey.Int(1),
+		EndLineKey.Int(1),
+	}, statement.Attributes)
+
+	for _, span := range spans {
+		require.Equal(t, codes.Error, span.Status.Code)
+		require.Equal(t, "syntax error", span.Status.Description)
+		require.Len(t, span.Events, 1)
+		require.Equal(t, "exception", span.Events[0].Name)
+	}
+}
+
+func TestTracerSuccess(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := NewTracer(provider)
+
+	_, endMigration := tracer.StartMigration(context.Background(), &libmigrate.MigrationStartedEvent{
+		Version:     2,
+		Name:        "drop_users",
+		Transaction: libmigrate.TransactionNone,
+	})
+	endMigration(nil)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, codes.Unset, spans[0].Status.Code)
+	require.Empty(t, spans[0].Events)
+	require.Contains(t, spans[0].Attributes, DirectionKey.String("down"))
+	require.Contains(t, spans[0].Attributes, TransactionKey.String("none"))
+}
+
+func TestTracerQueryText(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := NewTracer(provider, WithQueryText())
+
+	_, endStatement := tracer.StartStatement(context.Background(), &libmigrate.StatementEvent{
+		Statement: 1,
+		Total:     1,
+		StartLine: 1,
+		EndLine:   1,
+		SQL:       "CREATE TABLE users (id int)",
+	})
+	endStatement(nil)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Contains(t, spans[0].Attributes, QueryTextKey.String("CREATE TABLE users (id int)"))
+}
@@ -0,0 +1,150 @@
+package libmigrate
+
+import (
+	"context"
+	"fmt"
+)
+
+// A PlanStep is one migration MigrateTo would run.
+type PlanStep struct {
+	Version int
+	Name    string
+	IsUp    bool
+	// The migration file, or a description of a Go migration
+	Filename       string
+	UseTransaction bool
+	// Empty for Go migrations
+	SQL  string
+	IsGo bool
+}
+
+func (m *migrator) SetDryRun(dryRun bool) {
+	m.dryRun = dryRun
+}
+
+func (m *migrator) Plan(ctx context.Context, version int) ([]PlanStep, error) {
+	_, steps, err := m.plan(ctx, version)
+	return steps, err
+}
+
+// plan is Plan, also returning the version the steps start from.
+func (m *migrator) plan(ctx context.Context, version int) (currVersion int, steps []PlanStep, err error) {
+	// A plan is a preview, so it leaves the version table alone.
+	ctx = withReadOnly(ctx)
+
+	availableMigrations, err := m.listMigrations(ctx)
+	if err != nil {
+		return
+	}
+
+	err = m.requireClean(ctx)
+	if err != nil {
+		return
+	}
+
+	currVersion, err = m.currentVersion(ctx)
+	if err != nil {
+		return
+	}
+
+	path, isUp, err := migrationPath(availableMigrations, currVersion, version)
+	if err != nil {
+		return
+	}
+	steps, err = m.planSteps(path, isUp)
+	return
+}
+
+// migrationPath lists the migrations that take the database from one version
+// to another, in the order they run.
+func migrationPath(availableMigrations []migration, currVersion, version int) (path []migration, isUp bool, err error) {
+	if version < 0 {
+		return nil, false, &badVersionError{
+			version: version,
+			problem: "version must be 0 or higher",
+		}
+	}
+
+	if version > len(availableMigrations) {
+		return nil, false, &badVersionError{
+			version: version,
+			problem: fmt.Sprintf("max version is %d", len(availableMigrations)),
+		}
+	}
+
+	isUp = currVersion < version
+	if isUp {
+		path = availableMigrations[currVersion:version]
+		return
+	}
+
+	for v := currVersion; v > version; v-- {
+		path = append(path, availableMigrations[v-1])
+	}
+	return
+}
+
+// planSteps reads and checks each migration on the path, failing with every
+// problem found.
+func (m *migrator) planSteps(path []migration, isUp bool) ([]PlanStep, error) {
+	steps, problems := m.validatePath(path, isUp)
+	if err := newValidationError(problems); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+func (m *migrator) validatePath(path []migration, isUp bool) (steps []PlanStep, problems []error) {
+	for _, migration := range path {
+		step, err := m.planStep(migration, isUp)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		problems = append(problems, m.validateStep(step)...)
+		steps = append(steps, step)
+	}
+	return
+}
+
+func (m *migrator) planStep(migration migration, isUp bool) (step PlanStep, err error) {
+	if (isUp && !migration.HasUp) || (!isUp && !migration.HasDown) {
+		return step, &missingMigrationError{
+			version: migration.Version,
+			isUp:    isUp,
+		}
+	}
+
+	step = PlanStep{
+		Version:  migration.Version,
+		Name:     migration.Name,
+		IsUp:     isUp,
+		Filename: migration.label(isUp),
+		IsGo:     migration.Go != nil,
+	}
+
+	if migration.Go != nil {
+		step.UseTransaction = migration.Go.useTx(m.disableTransactions)
+		return
+	}
+
+	step.SQL, err = m.filesystem.ReadMigration(migration.Filename(isUp))
+	if err != nil {
+		return
+	}
+	step.UseTransaction = m.useTx(step.SQL)
+	return
+}
+
+// printPlan describes steps without running them.
+func (m *migrator) printPlan(ctx context.Context, steps []PlanStep) {
+	for _, step := range steps {
+		tx := ""
+		if !step.UseTransaction {
+			tx = " (no transaction)"
+		}
+		event := stepEvent(step, LogInfo, fmt.Sprintf("%s %s%s", stepNote(step.IsUp), step.Filename, tx))
+		event.Transaction = transactionMode(step.UseTransaction)
+		m.log(ctx, event)
+	}
+}
@@ -0,0 +1,96 @@
+package libmigrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	m, db, fs := Fixture(t)
+	db.requireSchema = func(ctx context.Context) error {
+		t.Fatal("Plan wrote the version table")
+		return nil
+	}
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{{Version: 1, Name: "v1"}}, nil
+	}
+	fs.readMigration = func(name string) (string, error) {
+		if name == "0003_v3.up.sql" {
+			return NoTransactionPrefix + "CREATE INDEX", nil
+		}
+		return "-- " + name, nil
+	}
+
+	steps, err := m.Plan(context.Background(), 3)
+	require.NoError(t, err)
+	require.Equal(t, []PlanStep{
+		{
+			Version:        2,
+			Name:           "v2",
+			IsUp:           true,
+			Filename:       "0002_v2.up.sql",
+			UseTransaction: true,
+			SQL:            "-- 0002_v2.up.sql",
+		},
+		{
+			Version:  3,
+			Name:     "v3",
+			IsUp:     true,
+			Filename: "0003_v3.up.sql",
+			SQL:      NoTransactionPrefix + "CREATE INDEX",
+		},
+	}, steps)
+
+	steps, err = m.Plan(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	require.Equal(t, "0001_v1.down.sql", steps[0].Filename)
+}
+
+func TestPlanMissingDown(t *testing.T) {
+	m, db, fs := Fixture(t)
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{{Version: 1, Name: "v1"}, {Version: 2, Name: "v2"}, {Version: 3, Name: "v3"}}, nil
+	}
+	fs.listMigrationDir = func() ([]string, error) {
+		return []string{
+			"0001_v1.up.sql",
+			"0001_v1.down.sql",
+			"0002_v2.up.sql",
+			"0003_v3.up.sql",
+			"0003_v3.down.sql",
+		}, nil
+	}
+
+	_, err := m.Plan(context.Background(), 0)
+	require.Equal(t, &missingMigrationError{version: 2, isUp: false}, err)
+}
+
+func TestDryRun(t *testing.T) {
+	m, db, _ := Fixture(t)
+	m.SetDryRun(true)
+	db.requireSchema = func(ctx context.Context) error {
+		t.Fatal("dry run wrote the version table")
+		return nil
+	}
+	db.tryLock = func(ctx context.Context) (func(context.Context) error, bool, error) {
+		t.Fatal("dry run took the lock")
+		return nil, false, nil
+	}
+	db.readMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{{Version: 1, Name: "v1"}}, nil
+	}
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		t.Fatal("dry run applied a migration")
+		return nil
+	}
+	logger := &recordLogger{}
+	m.SetLogger(logger)
+
+	err := m.MigrateLatest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "Migrating from 1 to 3", logger.events[0].Message)
+	require.Equal(t, "+ 0002_v2.up.sql", logger.events[2].Message)
+}
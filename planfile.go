@@ -0,0 +1,168 @@
+package libmigrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// planFileFormat is the version of the PlanFile layout. Bump it if the
+// layout changes incompatibly.
+const planFileFormat = 1
+
+// A PlanFile records the migrations MigrateTo would run, so they can be
+// reviewed and then run exactly as planned with ApplyPlan. Save it with
+// WritePlanFile and load it with ReadPlanFile.
+type PlanFile struct {
+	Format      int            `json:"format"`
+	FromVersion int            `json:"from_version"`
+	ToVersion   int            `json:"to_version"`
+	Steps       []PlanFileStep `json:"steps"`
+}
+
+type PlanFileStep struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	IsUp    bool   `json:"is_up"`
+	// Checksum of the migration file that runs, or "" for Go migrations
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func WritePlanFile(w io.Writer, plan *PlanFile) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
+
+func ReadPlanFile(r io.Reader) (*PlanFile, error) {
+	var plan PlanFile
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return nil, err
+	}
+	if plan.Format != planFileFormat {
+		return nil, &stalePlanError{
+			problem: fmt.Sprintf("unsupported plan format %d", plan.Format),
+		}
+	}
+	return &plan, nil
+}
+
+func (m *migrator) CreatePlan(ctx context.Context, version int) (*PlanFile, error) {
+	// Like Plan, this only reads the database, so it's safe to run before
+	// the plan is approved.
+	currVersion, steps, err := m.plan(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PlanFile{
+		Format:      planFileFormat,
+		FromVersion: currVersion,
+		ToVersion:   version,
+		Steps:       planFileSteps(steps),
+	}, nil
+}
+
+func planFileSteps(steps []PlanStep) []PlanFileStep {
+	result := make([]PlanFileStep, len(steps))
+	for i, step := range steps {
+		result[i] = PlanFileStep{
+			Version: step.Version,
+			Name:    step.Name,
+			IsUp:    step.IsUp,
+		}
+		if !step.IsGo {
+			result[i].Checksum = checksum(step.SQL)
+		}
+	}
+	return result
+}
+
+func (m *migrator) ApplyPlan(ctx context.Context, plan *PlanFile) (err error) {
+	ctx, run, err := m.beginRun(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		m.finishRun(ctx, run, err)
+	}()
+
+	availableMigrations, err := m.listMigrations(ctx)
+	if err != nil {
+		return
+	}
+
+	err = m.requireClean(ctx)
+	if err != nil {
+		return
+	}
+
+	currVersion, err := m.currentVersion(ctx)
+	if err != nil {
+		return
+	}
+	run.event.FromVersion, run.event.ToVersion = currVersion, plan.ToVersion
+	if currVersion != plan.FromVersion {
+		return &stalePlanError{
+			problem: fmt.Sprintf("the plan starts from version %d, but the database is at version %d", plan.FromVersion, currVersion),
+		}
+	}
+
+	path, isUp, err := migrationPath(availableMigrations, currVersion, plan.ToVersion)
+	if err != nil {
+		return
+	}
+	steps, err := m.planSteps(path, isUp)
+	if err != nil {
+		return
+	}
+
+	// Everything is checked before the first migration runs
+	err = verifyPlan(plan, planFileSteps(steps))
+	if err != nil {
+		return
+	}
+
+	if m.dryRun {
+		m.logf(ctx, "Dry run: nothing will be changed")
+		m.printPlan(ctx, steps)
+		return nil
+	}
+
+	m.log(ctx, LogEvent{
+		Message:     fmt.Sprintf("Applying plan from %d to %d", currVersion, plan.ToVersion),
+		FromVersion: currVersion,
+		ToVersion:   plan.ToVersion,
+	})
+	return m.applySteps(ctx, run, path, steps)
+}
+
+// verifyPlan checks that the steps planned now match the saved plan.
+func verifyPlan(plan *PlanFile, current []PlanFileStep) error {
+	if len(current) != len(plan.Steps) {
+		return &stalePlanError{
+			problem: fmt.Sprintf("the plan has %d steps, but %d are needed now", len(plan.Steps), len(current)),
+		}
+	}
+
+	for i, step := range current {
+		planned := plan.Steps[i]
+		switch {
+		case step.Version != planned.Version || step.IsUp != planned.IsUp:
+			return &stalePlanError{
+				problem: fmt.Sprintf("step %d has changed", i+1),
+			}
+		case step.Name != planned.Name:
+			return &stalePlanError{
+				problem: fmt.Sprintf("migration %d was renamed from %s to %s", step.Version, planned.Name, step.Name),
+			}
+		case step.Checksum != planned.Checksum:
+			return &stalePlanError{
+				problem: fmt.Sprintf("migration %d (%s) has been edited", step.Version, step.Name),
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package libmigrate
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func planFileFixture(t *testing.T) (*migrator, *dbMock, *fsMock, *[]int) {
+	m, db, fs := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return 1, nil }
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{{Version: 1, Name: "v1", Checksum: checksum("-- 0001_v1.up.sql")}}, nil
+	}
+	fs.readMigration = func(name string) (string, error) { return "-- " + name, nil }
+	var applied []int
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		applied = append(applied, version)
+		return nil
+	}
+	return m, db, fs, &applied
+}
+
+func TestPlanFileRoundTrip(t *testing.T) {
+	m, _, _, applied := planFileFixture(t)
+
+	plan, err := m.CreatePlan(context.Background(), 3)
+	require.NoError(t, err)
+	require.Equal(t, &PlanFile{
+		Format:      planFileFormat,
+		FromVersion: 1,
+		ToVersion:   3,
+		Steps: []PlanFileStep{
+			{Version: 2, Name: "v2", IsUp: true, Checksum: checksum("-- 0002_v2.up.sql")},
+			{Version: 3, Name: "v3", IsUp: true, Checksum: checksum("-- 0003_v3.up.sql")},
+		},
+	}, plan)
+
+	var b bytes.Buffer
+	require.NoError(t, WritePlanFile(&b, plan))
+	read, err := ReadPlanFile(&b)
+	require.NoError(t, err)
+	require.Equal(t, plan, read)
+
+	err = m.ApplyPlan(context.Background(), read)
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 3}, *applied)
+}
+
+func TestCreatePlanReadOnly(t *testing.T) {
+	m, db, _, _ := planFileFixture(t)
+	db.requireSchema = func(ctx context.Context) error {
+		t.Fatal("CreatePlan wrote the version table")
+		return nil
+	}
+	db.getVersion = func(ctx context.Context) (int, error) {
+		t.Fatal("CreatePlan read the version twice")
+		return 0, nil
+	}
+
+	plan, err := m.CreatePlan(context.Background(), 3)
+	require.NoError(t, err)
+	require.Equal(t, 1, plan.FromVersion)
+	require.Len(t, plan.Steps, 2)
+}
+
+func TestApplyPlanDryRun(t *testing.T) {
+	m, db, _, applied := planFileFixture(t)
+	plan, err := m.CreatePlan(context.Background(), 3)
+	require.NoError(t, err)
+
+	m.SetDryRun(true)
+	db.requireSchema = func(ctx context.Context) error {
+		t.Fatal("dry run wrote the version table")
+		return nil
+	}
+	db.tryLock = func(ctx context.Context) (func(context.Context) error, bool, error) {
+		t.Fatal("dry run took the lock")
+		return nil, false, nil
+	}
+	logger := &recordLogger{}
+	m.SetLogger(logger)
+
+	err = m.ApplyPlan(context.Background(), plan)
+	require.NoError(t, err)
+	require.Empty(t, *applied)
+	require.Equal(t, "Dry run: nothing will be changed", logger.events[0].Message)
+}
+
+func TestApplyPlanDatabaseChanged(t *testing.T) {
+	m, db, _, applied := planFileFixture(t)
+	plan, err := m.CreatePlan(context.Background(), 3)
+	require.NoError(t, err)
+
+	db.getVersion = func(ctx context.Context) (int, error) { return 2, nil }
+	err = m.ApplyPlan(context.Background(), plan)
+	require.Equal(t, &stalePlanError{
+		problem: "the plan starts from version 1, but the database is at version 2",
+	}, err)
+	require.Empty(t, *applied)
+}
+
+func TestApplyPlanFileEdited(t *testing.T) {
+	m, _, fs, applied := planFileFixture(t)
+	plan, err := m.CreatePlan(context.Background(), 3)
+	require.NoError(t, err)
+
+	fs.readMigration = func(name string) (string, error) {
+		if name == "0003_v3.up.sql" {
+			return "-- edited", nil
+		}
+		return "-- " + name, nil
+	}
+	err = m.ApplyPlan(context.Background(), plan)
+	require.Equal(t, &stalePlanError{problem: "migration 3 (v3) has been edited"}, err)
+	// Nothing ran, even though migration 2 is unchanged
+	require.Empty(t, *applied)
+}
+
+func TestReadPlanFileFormat(t *testing.T) {
+	_, err := ReadPlanFile(strings.NewReader(`{"format": 99}`))
+	require.Equal(t, &stalePlanError{problem: "unsupported plan format 99"}, err)
+}
@@ -0,0 +1,135 @@
+// Package prommigrate exports a libmigrate Migrator's state as Prometheus
+// metrics.
+//
+//	collector := prommigrate.NewCollector(migrator)
+//	migrator.AddObserver(collector) // For the duration metrics
+//	prometheus.MustRegister(collector)
+package prommigrate
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ojrac/libmigrate"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A Collector reports the schema version, latest available version and
+// pending migration count each time it's scraped, using Migrator.Health so
+// that scrapes never write to the database. Add it as an observer of the
+// Migrator to also report how long runs and migrations take.
+type Collector struct {
+	// How long a scrape waits for the database. Zero waits as long as the
+	// database takes. Default: 10 seconds
+	Timeout time.Duration
+
+	migrator libmigrate.Migrator
+
+	version            *prometheus.Desc
+	latest             *prometheus.Desc
+	pending            *prometheus.Desc
+	lastRun            *prometheus.Desc
+	migrationDurations *prometheus.HistogramVec
+
+	mu             sync.Mutex
+	lastRunSeconds float64
+	hasRun         bool
+}
+
+const defaultTimeout = 10 * time.Second
+
+func NewCollector(migrator libmigrate.Migrator) *Collector {
+	return &Collector{
+		Timeout:  defaultTimeout,
+		migrator: migrator,
+		version: prometheus.NewDesc(
+			"libmigrate_schema_version",
+			"The database's current migration version.",
+			nil, nil),
+		latest: prometheus.NewDesc(
+			"libmigrate_latest_version",
+			"The latest migration version available.",
+			nil, nil),
+		pending: prometheus.NewDesc(
+			"libmigrate_pending_migrations",
+			"The number of available migrations that haven't been applied.",
+			nil, nil),
+		lastRun: prometheus.NewDesc(
+			"libmigrate_last_run_duration_seconds",
+			"How long the last migration run took.",
+			nil, nil),
+		migrationDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "libmigrate_migration_duration_seconds",
+			Help:    "How long each successful migration took to apply or roll back.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+		}, []string{"version", "name", "direction"}),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.version
+	ch <- c.latest
+	ch <- c.pending
+	ch <- c.lastRun
+	c.migrationDurations.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	c.collectVersions(ctx, ch)
+
+	c.mu.Lock()
+	if c.hasRun {
+		ch <- prometheus.MustNewConstMetric(c.lastRun, prometheus.GaugeValue, c.lastRunSeconds)
+	}
+	c.mu.Unlock()
+
+	c.migrationDurations.Collect(ch)
+}
+
+func (c *Collector) collectVersions(ctx context.Context, ch chan<- prometheus.Metric) {
+	health, err := c.migrator.Health(ctx)
+	if err != nil {
+		c.invalid(ch, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.version, prometheus.GaugeValue, float64(health.CurrentVersion))
+	ch <- prometheus.MustNewConstMetric(c.latest, prometheus.GaugeValue, float64(health.LatestVersion))
+	ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(len(health.Pending)))
+}
+
+// invalid reports that the metrics read from the database are unavailable.
+func (c *Collector) invalid(ch chan<- prometheus.Metric, err error) {
+	ch <- prometheus.NewInvalidMetric(c.version, err)
+	ch <- prometheus.NewInvalidMetric(c.latest, err)
+	ch <- prometheus.NewInvalidMetric(c.pending, err)
+}
+
+// Observe records the duration metrics; see libmigrate.Migrator.AddObserver.
+func (c *Collector) Observe(ctx context.Context, event libmigrate.Event) {
+	switch e := event.(type) {
+	case *libmigrate.MigrationFinishedEvent:
+		c.observeMigration(e.Version, e.Name, e.IsUp, e.Duration.Seconds())
+	case *libmigrate.RunFinishedEvent:
+		c.mu.Lock()
+		c.lastRunSeconds = e.Duration.Seconds()
+		c.hasRun = true
+		c.mu.Unlock()
+	}
+}
+
+func (c *Collector) observeMigration(version int, name string, isUp bool, seconds float64) {
+	direction := "down"
+	if isUp {
+		direction = "up"
+	}
+	c.migrationDurations.WithLabelValues(strconv.Itoa(version), name, direction).Observe(seconds)
+}
@@ -0,0 +1,108 @@
+package prommigrate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ojrac/libmigrate"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMigrator implements just the methods a Collector calls.
+type fakeMigrator struct {
+	libmigrate.Migrator
+	health   *libmigrate.HealthStatus
+	err      error
+	deadline time.Time
+}
+
+func (m *fakeMigrator) Health(ctx context.Context) (*libmigrate.HealthStatus, error) {
+	m.deadline, _ = ctx.Deadline()
+	return m.health, m.err
+}
+
+func TestCollector(t *testing.T) {
+	migrator := &fakeMigrator{
+		health: &libmigrate.HealthStatus{
+			CurrentVersion: 1,
+			LatestVersion:  3,
+			Pending: []libmigrate.MigrationStatus{
+				{Version: 2, Name: "b", OnFilesystem: true},
+				{Version: 3, Name: "c", OnFilesystem: true},
+			},
+		},
+	}
+	collector := NewCollector(migrator)
+	collector.Timeout = time.Minute
+	start := time.Now()
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP libmigrate_latest_version The latest migration version available.
+# TYPE libmigrate_latest_version gauge
+libmigrate_latest_version 3
+# HELP libmigrate_pending_migrations The number of available migrations that haven't been applied.
+# TYPE libmigrate_pending_migrations gauge
+libmigrate_pending_migrations 2
+# HELP libmigrate_schema_version The database's current migration version.
+# TYPE libmigrate_schema_version gauge
+libmigrate_schema_version 1
+`))
+	require.NoError(t, err)
+	require.WithinDuration(t, start.Add(time.Minute), migrator.deadline, 10*time.Second)
+}
+
+func TestCollectorDurations(t *testing.T) {
+	collector := NewCollector(&fakeMigrator{health: &libmigrate.HealthStatus{}})
+	ctx := context.Background()
+	collector.Observe(ctx, &libmigrate.MigrationFinishedEvent{
+		Version:  1,
+		Name:     "a",
+		IsUp:     true,
+		Duration: 20 * time.Millisecond,
+	})
+	collector.Observe(ctx, &libmigrate.MigrationFailedEvent{
+		Version: 2,
+		Name:    "b",
+		IsUp:    true,
+		Err:     errors.New("failed"),
+	})
+	collector.Observe(ctx, &libmigrate.RunFinishedEvent{Duration: 1500 * time.Millisecond})
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP libmigrate_last_run_duration_seconds How long the last migration run took.
+# TYPE libmigrate_last_run_duration_seconds gauge
+libmigrate_last_run_duration_seconds 1.5
+`), "libmigrate_last_run_duration_seconds")
+	require.NoError(t, err)
+
+	histogram := collector.migrationDurations.WithLabelValues("1", "a", "up").(prometheus.Histogram)
+	require.Equal(t, 1, testutil.CollectAndCount(histogram))
+	require.Equal(t, 1, testutil.CollectAndCount(collector, "libmigrate_migration_duration_seconds"))
+}
+
+func TestCollectorError(t *testing.T) {
+	collector := NewCollector(&fakeMigrator{err: errors.New("connection refused")})
+
+	_, err := testutil.CollectAndLint(collector)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "connection refused")
+}
+
+func TestCollectorNoTimeout(t *testing.T) {
+	migrator := &fakeMigrator{health: &libmigrate.HealthStatus{CurrentVersion: 2, LatestVersion: 2}}
+	collector := NewCollector(migrator)
+	collector.Timeout = 0
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP libmigrate_schema_version The database's current migration version.
+# TYPE libmigrate_schema_version gauge
+libmigrate_schema_version 2
+`), "libmigrate_schema_version")
+	require.NoError(t, err)
+	require.True(t, migrator.deadline.IsZero())
+}
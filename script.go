@@ -0,0 +1,195 @@
+package libmigrate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+func (m *migrator) WriteScript(w io.Writer, fromVersion, toVersion int) (err error) {
+	names, err := m.filesystem.ListMigrationDir()
+	if err != nil {
+		return
+	}
+	migrationsByVersion, err := parseMigrationFilenames(names, m.goMigrations)
+	if err != nil {
+		return
+	}
+
+	if fromVersion < 0 || fromVersion > len(migrationsByVersion) {
+		return &badVersionError{
+			version: fromVersion,
+			problem: fmt.Sprintf("starting version must be between 0 and %d", len(migrationsByVersion)),
+		}
+	}
+
+	path, isUp, err := migrationPath(sortMigrations(migrationsByVersion), fromVersion, toVersion)
+	if err != nil {
+		return
+	}
+
+	steps, err := m.planSteps(path, isUp)
+	if err != nil {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Migrate from version %d to %d\n", fromVersion, toVersion)
+	b.WriteString(scriptStopOnError(m.dialect))
+	if fromVersion == 0 && toVersion > 0 {
+		fmt.Fprintf(&b, "\n-- Version table\n%s\n", m.db.ScriptSchema())
+	}
+
+	for _, step := range steps {
+		if step.IsGo {
+			return &goMigrationScriptError{version: step.Version, name: step.Name}
+		}
+		m.writeScriptStep(&b, step)
+	}
+	if _, ok := m.dialect.(SQLServerDialect); ok {
+		// Undo the SET NOEXEC ON of a failed step
+		b.WriteString("\nSET NOEXEC OFF;\nGO\n")
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return
+}
+
+// writeScriptStep writes a migration the way ApplyMigration runs it.
+func (m *migrator) writeScriptStep(b *strings.Builder, step PlanStep) {
+	var sum string
+	if step.IsUp {
+		sum = checksum(step.SQL)
+	}
+
+	tx := ""
+	if !step.UseTransaction {
+		tx = " (no transaction)"
+	}
+	fmt.Fprintf(b, "\n-- %s%s\n", step.Filename, tx)
+
+	_, sqlServer := m.dialect.(SQLServerDialect)
+	if step.UseTransaction {
+		if sqlServer {
+			// Roll back on any error, rather than only the failed statement
+			b.WriteString("SET XACT_ABORT ON;\n")
+		}
+		fmt.Fprintf(b, "%s\n", beginTransactionSQL(m.dialect))
+	}
+	if sqlServer && step.UseTransaction {
+		// A rolled back transaction doesn't stop later batches, which would
+		// then run outside it, so each is guarded.
+		for _, batch := range splitBatches(step.SQL) {
+			fmt.Fprintf(b, "%s\nGO\n", batch.SQL)
+			fmt.Fprintf(b, "IF @@TRANCOUNT = 0 BEGIN RAISERROR(%s, 16, 1); SET NOEXEC ON; END;\nGO\n",
+				quoteLiteral(m.dialect, step.Filename+" failed; skipping the rest of the script"))
+		}
+	} else {
+		b.WriteString(strings.TrimRight(step.SQL, " \t\r\n"))
+		b.WriteString(scriptStatementEnd(m.dialect, step.SQL))
+	}
+	fmt.Fprintf(b, "%s\n", m.db.ScriptRecord(step.IsUp, step.Version, step.Name, sum))
+	if step.UseTransaction {
+		b.WriteString("COMMIT;\n")
+	}
+	if sqlServer {
+		b.WriteString("GO\n")
+	}
+}
+
+// scriptStatementEnd ends a migration, so the statements after it aren't
+// run as part of its last statement.
+func scriptStatementEnd(d Dialect, sql string) string {
+	if _, ok := d.(SQLServerDialect); ok {
+		// Statements like CREATE PROCEDURE take up the rest of their batch
+		return "\nGO\n"
+	}
+
+	statements := splitStatementsFor(d, sql)
+	if len(statements) > 0 && !strings.HasSuffix(statements[len(statements)-1].SQL, ";") {
+		return ";\n"
+	}
+	return "\n"
+}
+
+// scriptStopOnError makes the script stop at the first error, where the
+// dialect's client can be told to. Otherwise a failed migration would still
+// be recorded, or later migrations would run after it.
+func scriptStopOnError(d Dialect) string {
+	switch d.(type) {
+	case PostgresDialect:
+		return "-- psql continues after an error unless told otherwise\n\\set ON_ERROR_STOP on\n"
+	case SQLiteDialect:
+		return "-- The sqlite3 shell continues after an error unless told otherwise\n.bail on\n"
+	case MySQLDialect:
+		return "-- Run without --force, so the mysql client stops at the first error\n"
+	case SQLServerDialect:
+		// Each migration is guarded with SET NOEXEC ON
+		return ""
+	}
+	return "-- Run this script so that it stops at the first error\n"
+}
+
+func beginTransactionSQL(d Dialect) string {
+	if _, ok := d.(SQLServerDialect); ok {
+		return "BEGIN TRANSACTION;"
+	}
+	return "BEGIN;"
+}
+
+// quoteLiteral quotes a string for use in a script.
+func quoteLiteral(d Dialect, s string) string {
+	if _, ok := d.(MySQLDialect); ok {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func quoteNullableLiteral(d Dialect, s string) string {
+	if s == "" {
+		return "NULL"
+	}
+	return quoteLiteral(d, s)
+}
+
+// ScriptSchema returns statements creating the version table, at its current
+// layout, for a script run against a new database.
+func (w *dbWrapperImpl) ScriptSchema() string {
+	// These must match the columns metaMigrations create
+	text := textType(w.dialect, false)
+	createTable := w.dialect.CreateTableSQL(w.fullTableName(), []string{
+		"version integer PRIMARY KEY NOT NULL",
+		"name " + textType(w.dialect, true) + " NOT NULL",
+		"checksum " + text,
+		"applied_at " + text,
+		"duration_ms integer",
+		"applied_by " + text,
+		"libmigrate_version " + text,
+		"dirty " + text,
+	})
+	createMetaTable := w.dialect.CreateTableSQL(w.fullMetaTableName(), []string{
+		"schema_version integer NOT NULL",
+	})
+
+	return strings.Join([]string{
+		strings.TrimSpace(createTable),
+		strings.TrimSpace(createMetaTable),
+		fmt.Sprintf("INSERT INTO %s (schema_version) VALUES (%d);",
+			w.fullMetaTableName(), len(metaMigrations)),
+	}, "\n")
+}
+
+// ScriptRecord returns the statement ApplyMigration uses to record a
+// migration, with its values inlined. The time and duration aren't known
+// ahead of time, so they're left empty.
+func (w *dbWrapperImpl) ScriptRecord(isUp bool, version int, name, checksum string) string {
+	if isUp {
+		return fmt.Sprintf(
+			"INSERT INTO %s (version, name, checksum, applied_by, libmigrate_version) VALUES (%d, %s, %s, %s, %s);",
+			w.fullTableName(), version, quoteLiteral(w.dialect, name), quoteLiteral(w.dialect, checksum),
+			quoteNullableLiteral(w.dialect, w.appliedBy), quoteLiteral(w.dialect, libraryVersion()))
+	}
+
+	return fmt.Sprintf("DELETE FROM %s WHERE version = %d AND name = %s;",
+		w.fullTableName(), version, quoteLiteral(w.dialect, name))
+}
@@ -0,0 +1,126 @@
+package libmigrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scriptFixture(dialect Dialect) *migrator {
+	m := internalNew(nil, fstest.MapFS{
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id int);\n")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;\n")},
+		"0002_second.up.sql":   {Data: []byte(NoTransactionPrefix + "CREATE INDEX CONCURRENTLY b ON a (id)")},
+		"0002_second.down.sql": {Data: []byte("DROP INDEX b;\n")},
+	}, "", dialect)
+	m.SetAppliedBy("o'brien")
+	return m
+}
+
+func TestWriteScript(t *testing.T) {
+	m := scriptFixture(PostgresDialect{})
+
+	var b strings.Builder
+	err := m.WriteScript(&b, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, `-- Migrate from version 1 to 2
+-- psql continues after an error unless told otherwise
+\set ON_ERROR_STOP on
+
+-- 0002_second.up.sql (no transaction)
+`+NoTransactionPrefix+`CREATE INDEX CONCURRENTLY b ON a (id);
+INSERT INTO "migration_version" (version, name, checksum, applied_by, libmigrate_version) VALUES (2, 'second', '`+
+		checksum(NoTransactionPrefix+"CREATE INDEX CONCURRENTLY b ON a (id)")+`', 'o''brien', '`+libraryVersion()+`');
+`, b.String())
+
+	b.Reset()
+	err = m.WriteScript(&b, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, `-- Migrate from version 2 to 0
+-- psql continues after an error unless told otherwise
+\set ON_ERROR_STOP on
+
+-- 0002_second.down.sql
+BEGIN;
+DROP INDEX b;
+DELETE FROM "migration_version" WHERE version = 2 AND name = 'second';
+COMMIT;
+
+-- 0001_first.down.sql
+BEGIN;
+DROP TABLE a;
+DELETE FROM "migration_version" WHERE version = 1 AND name = 'first';
+COMMIT;
+`, b.String())
+}
+
+func TestWriteScriptCreatesVersionTable(t *testing.T) {
+	m := scriptFixture(SQLServerDialect{})
+
+	var b strings.Builder
+	err := m.WriteScript(&b, 0, 1)
+	require.NoError(t, err)
+	require.Contains(t, b.String(), "CREATE TABLE [migration_version] (")
+	require.Contains(t, b.String(), "INSERT INTO [migration_version_meta] (schema_version) VALUES (4);")
+	require.True(t, strings.HasSuffix(b.String(), `
+-- 0001_first.up.sql
+SET XACT_ABORT ON;
+BEGIN TRANSACTION;
+CREATE TABLE a (id int);
+GO
+IF @@TRANCOUNT = 0 BEGIN RAISERROR('0001_first.up.sql failed; skipping the rest of the script', 16, 1); SET NOEXEC ON; END;
+GO
+INSERT INTO [migration_version] (version, name, checksum, applied_by, libmigrate_version) VALUES (1, 'first', '`+
+		checksum("CREATE TABLE a (id int);\n")+`', 'o''brien', '`+libraryVersion()+`');
+COMMIT;
+GO
+
+SET NOEXEC OFF;
+GO
+`), b.String())
+}
+
+func TestWriteScriptSQLServerBatches(t *testing.T) {
+	m := internalNew(nil, fstest.MapFS{
+		"0001_first.up.sql": {Data: []byte("CREATE TABLE a (id int);\nGO\nCREATE PROCEDURE p AS SELECT 1;\n")},
+	}, "", SQLServerDialect{})
+
+	var b strings.Builder
+	err := m.WriteScript(&b, 0, 1)
+	require.NoError(t, err)
+	guard := "IF @@TRANCOUNT = 0 BEGIN RAISERROR('0001_first.up.sql failed; skipping the rest of the script', 16, 1); SET NOEXEC ON; END;\nGO\n"
+	require.Contains(t, b.String(), "BEGIN TRANSACTION;\n"+
+		"CREATE TABLE a (id int);\nGO\n"+guard+
+		"CREATE PROCEDURE p AS SELECT 1;\nGO\n"+guard+
+		"INSERT INTO [migration_version]")
+}
+
+func TestWriteScriptStopOnError(t *testing.T) {
+	for dialect, expected := range map[Dialect]string{
+		SQLiteDialect{}:       "\n.bail on\n",
+		MySQLDialect{}:        "\n-- Run without --force, so the mysql client stops at the first error\n",
+		ParamTypeQuestionMark: "\n-- Run this script so that it stops at the first error\n",
+	} {
+		var b strings.Builder
+		err := scriptFixture(dialect).WriteScript(&b, 1, 2)
+		require.NoError(t, err)
+		require.Contains(t, b.String(), expected)
+	}
+}
+
+func TestWriteScriptGoMigration(t *testing.T) {
+	m := scriptFixture(PostgresDialect{})
+	m.AddGoMigration(GoMigration{Version: 3, Name: "go", Up: noopGoMigration})
+
+	err := m.WriteScript(&strings.Builder{}, 2, 3)
+	require.Equal(t, &goMigrationScriptError{version: 3, name: "go"}, err)
+}
+
+func TestWriteScriptBadVersion(t *testing.T) {
+	m := scriptFixture(PostgresDialect{})
+
+	err := m.WriteScript(&strings.Builder{}, 3, 0)
+	require.IsType(t, &badVersionError{}, err)
+}
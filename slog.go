@@ -0,0 +1,60 @@
+//go:build go1.21
+// +build go1.21
+
+package libmigrate
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogLogger returns a Logger that sends each event to h, with its fields
+// as attributes. Fields that don't apply to an event are left out.
+func NewSlogLogger(h slog.Handler) Logger {
+	return &slogLogger{logger: slog.New(h)}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l *slogLogger) Log(ctx context.Context, event LogEvent) {
+	var attrs []slog.Attr
+	if event.Version != 0 {
+		attrs = append(attrs,
+			slog.Int("version", event.Version),
+			slog.String("name", event.Name),
+			slog.String("direction", event.Direction),
+		)
+	}
+	if event.Transaction != "" {
+		attrs = append(attrs, slog.String("transaction", event.Transaction))
+	}
+	if event.FromVersion != 0 || event.ToVersion != 0 {
+		attrs = append(attrs,
+			slog.Int("from_version", event.FromVersion),
+			slog.Int("to_version", event.ToVersion),
+		)
+	}
+	if event.Duration != 0 {
+		attrs = append(attrs, slog.Duration("duration", event.Duration))
+	}
+	if event.Err != nil {
+		attrs = append(attrs, slog.String("error", event.Err.Error()))
+	}
+
+	l.logger.LogAttrs(ctx, slogLevel(event.Level), event.Message, attrs...)
+}
+
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LogDebug:
+		return slog.LevelDebug
+	case LogWarn:
+		return slog.LevelWarn
+	case LogError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
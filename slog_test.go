@@ -0,0 +1,60 @@
+//go:build go1.21
+// +build go1.21
+
+package libmigrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logger := NewSlogLogger(handler)
+
+	logger.Log(context.Background(), LogEvent{
+		Level:     LogError,
+		Message:   "0002_v2.up.sql failed: boom",
+		Version:   2,
+		Name:      "v2",
+		Direction: "up",
+		Duration:  time.Second,
+		Err:       errors.New("boom"),
+	})
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	delete(record, "time")
+	require.Equal(t, map[string]interface{}{
+		"level":     "ERROR",
+		"msg":       "0002_v2.up.sql failed: boom",
+		"version":   float64(2),
+		"name":      "v2",
+		"direction": "up",
+		"duration":  float64(time.Second),
+		"error":     "boom",
+	}, record)
+
+	buf.Reset()
+	logger.Log(context.Background(), LogEvent{
+		Message:   "Migrating from 0 to 3",
+		ToVersion: 3,
+	})
+	record = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	delete(record, "time")
+	require.Equal(t, map[string]interface{}{
+		"level":        "INFO",
+		"msg":          "Migrating from 0 to 3",
+		"from_version": float64(0),
+		"to_version":   float64(3),
+	}, record)
+}
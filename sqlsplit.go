@@ -0,0 +1,393 @@
+package libmigrate
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A statement is one piece of a migration, as it's sent to the database.
+type statement struct {
+	SQL string
+	// Lines of the migration file it spans, counting from 1
+	StartLine int
+	EndLine   int
+}
+
+// Dialects that implement this have their migrations sent to the database
+// one statement at a time.
+type statementSplitter interface {
+	splitStatements(sql string) []statement
+}
+
+func (PostgresDialect) splitStatements(sql string) []statement {
+	return sqlSplitter{dollarQuotes: true}.split(sql)
+}
+
+func (SQLiteDialect) splitStatements(sql string) []statement {
+	return sqlSplitter{}.split(sql)
+}
+
+func (MySQLDialect) splitStatements(sql string) []statement {
+	return sqlSplitter{
+		backslashEscapes: true,
+		hashComments:     true,
+	}.split(sql)
+}
+
+// SQL Server runs each batch as a whole; statements within it aren't split.
+func (SQLServerDialect) splitStatements(sql string) []statement {
+	return splitBatches(sql)
+}
+
+// splitStatementsFor splits sql the way d would run it, or with generic rules
+// if d sends migrations whole.
+func splitStatementsFor(d Dialect, sql string) []statement {
+	if s, ok := d.(statementSplitter); ok {
+		return s.splitStatements(sql)
+	}
+	return sqlSplitter{}.split(sql)
+}
+
+// sqlSplitter breaks a migration into statements at semicolons, skipping
+// over quoted strings, quoted identifiers, comments, and the bodies of
+// triggers and procedures (BEGIN ... END).
+type sqlSplitter struct {
+	// Backslashes escape quotes inside strings (MySQL)
+	backslashEscapes bool
+	// "#" starts a comment, and "/*! ... */" is code (MySQL)
+	hashComments bool
+	// $tag$ quoted strings and E'' escape strings (PostgreSQL)
+	dollarQuotes bool
+}
+
+func (s sqlSplitter) split(sql string) (statements []statement) {
+	lines := newLineIndex(sql)
+	codeStart := -1 // Offset of the current statement's first code
+	firstWord := ""
+	prevWord := ""
+	routine := false // Whether the current statement can have a body
+	depth := 0       // Nesting of BEGIN ... END blocks
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"),
+			c == '#' && s.hashComments:
+			i = skipLineComment(sql, i)
+			continue
+		case c == '/' && strings.HasPrefix(sql[i:], "/*") &&
+			!(s.hashComments && strings.HasPrefix(sql[i:], "/*!")):
+			i = skipBlockComment(sql, i)
+			continue
+		case unicode.IsSpace(rune(c)):
+			continue
+		case c == ';' && depth == 0:
+			if codeStart >= 0 {
+				statements = append(statements, lines.statement(sql, codeStart, i+1))
+			}
+			codeStart = -1
+			firstWord = ""
+			prevWord = ""
+			routine = false
+			continue
+		}
+
+		if codeStart < 0 {
+			codeStart = i
+		}
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(sql, i, s.backslashEscapes && c != '`')
+		case c == '$' && s.dollarQuotes && !isWordChar(sql, i-1):
+			i = skipDollarQuoted(sql, i)
+		case isWordStart(sql, i):
+			end := wordEnd(sql, i)
+			word := strings.ToUpper(sql[i:end])
+			if s.dollarQuotes && word == "E" && end < len(sql) && sql[end] == '\'' {
+				i = skipQuoted(sql, end, true)
+				continue
+			}
+
+			if firstWord == "" {
+				firstWord = word
+			} else if firstWord == "CREATE" && depth == 0 {
+				switch word {
+				case "TRIGGER", "PROCEDURE", "FUNCTION", "EVENT":
+					routine = true
+				}
+			}
+			depth = nestBlocks(depth, routine, firstWord, prevWord, word, nextWord(sql, end))
+			prevWord = word
+			i = end - 1
+		}
+	}
+
+	if codeStart >= 0 {
+		statements = append(statements, lines.statement(sql, codeStart, len(sql)))
+	}
+	return
+}
+
+// nestBlocks tracks BEGIN ... END blocks, so semicolons inside them don't end
+// the statement. A BEGIN outside of CREATE TRIGGER/PROCEDURE/... starts a
+// transaction, not a block (except MariaDB's BEGIN NOT ATOMIC).
+func nestBlocks(depth int, routine bool, firstWord, prev, word, next string) int {
+	switch word {
+	case "BEGIN":
+		if depth > 0 || routine || (firstWord == "BEGIN" && next == "NOT") {
+			return depth + 1
+		}
+	case "CASE":
+		// MySQL's END CASE closes a CASE statement; the END counted it
+		if depth > 0 && prev != "END" {
+			return depth + 1
+		}
+	case "END":
+		switch next {
+		case "IF", "LOOP", "WHILE", "REPEAT", "FOR":
+			// These close blocks we don't count
+			return depth
+		}
+		if depth > 0 {
+			return depth - 1
+		}
+	}
+	return depth
+}
+
+// splitBatches breaks a T-SQL script into batches at "GO" lines outside of
+// comments and strings. "GO 3" repeats the batch before it three times.
+func splitBatches(sql string) (batches []statement) {
+	lines := newLineIndex(sql)
+	codeStart := -1
+
+	for i := 0; i < len(sql); i++ {
+		if i == 0 || sql[i-1] == '\n' {
+			lineEnd := skipLineComment(sql, i)
+			if count, ok := parseGoLine(sql[i:lineEnd]); ok {
+				if codeStart >= 0 {
+					batch := lines.statement(sql, codeStart, i)
+					for n := 0; n < count; n++ {
+						batches = append(batches, batch)
+					}
+				}
+				codeStart = -1
+				i = lineEnd - 1
+				continue
+			}
+		}
+
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			i = skipLineComment(sql, i)
+			continue
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+			continue
+		case unicode.IsSpace(rune(c)):
+			continue
+		}
+
+		if codeStart < 0 {
+			codeStart = i
+		}
+
+		switch c {
+		case '\'', '"':
+			i = skipQuoted(sql, i, false)
+		case '[':
+			if end := strings.IndexByte(sql[i:], ']'); end >= 0 {
+				i += end
+			} else {
+				i = len(sql)
+			}
+		}
+	}
+
+	if codeStart >= 0 {
+		batches = append(batches, lines.statement(sql, codeStart, len(sql)))
+	}
+	return
+}
+
+// parseGoLine checks whether line is a batch separator: "GO", optionally
+// followed by a repeat count and a "--" comment.
+func parseGoLine(line string) (count int, ok bool) {
+	if comment := strings.Index(line, "--"); comment >= 0 {
+		line = line[:comment]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 || !strings.EqualFold(fields[0], "GO") {
+		return 0, false
+	}
+	if len(fields) == 1 {
+		return 1, true
+	}
+
+	count, err := strconv.Atoi(fields[1])
+	if err != nil || count < 1 {
+		return 0, false
+	}
+	return count, true
+}
+
+// lineIndex finds line numbers by offset.
+type lineIndex []int // Offsets of each '\n'
+
+func newLineIndex(sql string) (index lineIndex) {
+	for i := 0; i < len(sql); i++ {
+		if sql[i] == '\n' {
+			index = append(index, i)
+		}
+	}
+	return
+}
+
+func (index lineIndex) line(offset int) int {
+	return sort.SearchInts(index, offset) + 1
+}
+
+// statement makes a statement of sql[start:end], minus trailing whitespace.
+func (index lineIndex) statement(sql string, start, end int) statement {
+	text := strings.TrimRightFunc(sql[start:end], unicode.IsSpace)
+	return statement{
+		SQL:       text,
+		StartLine: index.line(start),
+		EndLine:   index.line(start + len(text) - 1),
+	}
+}
+
+// skipQuoted returns the index of the quote closing the one at sql[start].
+func skipQuoted(sql string, start int, backslashEscapes bool) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if backslashEscapes {
+				i++
+			}
+		case quote:
+			// A doubled quote is an escaped quote
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(sql)
+}
+
+// skipDollarQuoted returns the index of the end of the $tag$ quoted string
+// starting at sql[start]. If sql[start] doesn't start one (e.g. it's a $1
+// parameter), it returns start.
+func skipDollarQuoted(sql string, start int) int {
+	end := start + 1
+	if end < len(sql) && (unicode.IsLetter(rune(sql[end])) || sql[end] == '_') {
+		end = wordEnd(sql, end)
+	}
+	if end >= len(sql) || sql[end] != '$' {
+		return start
+	}
+
+	tag := sql[start : end+1]
+	if close := strings.Index(sql[end+1:], tag); close >= 0 {
+		return end + close + len(tag)
+	}
+	return len(sql)
+}
+
+// skipLineComment returns the index of the newline ending the comment at
+// sql[start].
+func skipLineComment(sql string, start int) int {
+	if end := strings.IndexByte(sql[start:], '\n'); end >= 0 {
+		return start + end
+	}
+	return len(sql)
+}
+
+// skipBlockComment returns the index of the "/" ending the comment at
+// sql[start].
+func skipBlockComment(sql string, start int) int {
+	if end := strings.Index(sql[start+2:], "*/"); end >= 0 {
+		return start + 2 + end + 1
+	}
+	return len(sql)
+}
+
+func isWordChar(sql string, i int) bool {
+	if i < 0 || i >= len(sql) {
+		return false
+	}
+	c := rune(sql[i])
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '$'
+}
+
+func isWordStart(sql string, i int) bool {
+	c := rune(sql[i])
+	return (unicode.IsLetter(c) || c == '_') && !isWordChar(sql, i-1)
+}
+
+// wordEnd returns the end of the word at sql[start]. It stops at "$" so
+// that $tag$ delimiters can be found.
+func wordEnd(sql string, start int) int {
+	end := start
+	for end < len(sql) && isWordChar(sql, end) && sql[end] != '$' {
+		end++
+	}
+	return end
+}
+
+// nextWord returns the word at or after sql[start], upper cased, or "" if
+// something else comes next.
+func nextWord(sql string, start int) string {
+	for i := start; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"), c == '#':
+			i = skipLineComment(sql, i)
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+		case unicode.IsSpace(rune(c)):
+		case isWordStart(sql, i):
+			return strings.ToUpper(sql[i:wordEnd(sql, i)])
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// statementKeyword returns the first keyword of a statement, upper cased.
+func statementKeyword(statement string) string {
+	return nextWord(statement, 0)
+}
+
+// isDDL reports whether a statement changes the schema. MySQL commits these
+// implicitly, even inside a transaction.
+func isDDL(statement string) bool {
+	switch statementKeyword(statement) {
+	case "CREATE", "ALTER", "DROP", "RENAME", "TRUNCATE":
+		return true
+	}
+	return false
+}
+
+// isAtomicWithoutTransactionalDDL reports whether a migration can still be
+// rolled back as a unit by a database that commits DDL implicitly: either it
+// has no DDL, or the DDL is its only statement.
+func isAtomicWithoutTransactionalDDL(statements []statement) bool {
+	if len(statements) <= 1 {
+		return true
+	}
+	for _, statement := range statements {
+		if isDDL(statement.SQL) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,254 @@
+package libmigrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func statementSQL(statements []statement) (result []string) {
+	for _, s := range statements {
+		result = append(result, s.SQL)
+	}
+	return
+}
+
+func TestSplitStatements(t *testing.T) {
+	cases := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{
+			name:     "empty",
+			sql:      "  \n-- nothing here\n;\n",
+			expected: nil,
+		},
+		{
+			name:     "single without semicolon",
+			sql:      "SELECT 1",
+			expected: []string{"SELECT 1"},
+		},
+		{
+			name: "multiple",
+			sql:  "CREATE TABLE a (id int);\nINSERT INTO a VALUES (1);\n",
+			expected: []string{
+				"CREATE TABLE a (id int);",
+				"INSERT INTO a VALUES (1);",
+			},
+		},
+		{
+			name: "quotes",
+			sql:  `INSERT INTO a VALUES ('x;y', "it""s;", 'it''s;');SELECT 2;`,
+			expected: []string{
+				`INSERT INTO a VALUES ('x;y', "it""s;", 'it''s;');`,
+				`SELECT 2;`,
+			},
+		},
+		{
+			name: "comments",
+			sql:  "-- first; comment\nSELECT 1; /* block; comment */ SELECT 2;\n-- trailing;",
+			expected: []string{
+				"SELECT 1;",
+				"SELECT 2;",
+			},
+		},
+		{
+			name: "backslashes aren't escapes",
+			sql:  `SELECT 'a\'; SELECT 2;`,
+			expected: []string{
+				`SELECT 'a\';`,
+				`SELECT 2;`,
+			},
+		},
+		{
+			name: "transactions",
+			sql:  "BEGIN;\nUPDATE a SET b = 1;\nCOMMIT;\nBEGIN TRANSACTION; END;",
+			expected: []string{
+				"BEGIN;",
+				"UPDATE a SET b = 1;",
+				"COMMIT;",
+				"BEGIN TRANSACTION;",
+				"END;",
+			},
+		},
+		{
+			name: "trigger",
+			sql: `CREATE TRIGGER t AFTER INSERT ON a BEGIN
+	UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;
+	DELETE FROM c;
+END;
+SELECT 1;`,
+			expected: []string{
+				`CREATE TRIGGER t AFTER INSERT ON a BEGIN
+	UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;
+	DELETE FROM c;
+END;`,
+				"SELECT 1;",
+			},
+		},
+		{
+			name: "case outside a block",
+			sql:  "SELECT CASE WHEN x THEN 1 END FROM a; SELECT 2;",
+			expected: []string{
+				"SELECT CASE WHEN x THEN 1 END FROM a;",
+				"SELECT 2;",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, statementSQL(sqlSplitter{}.split(c.sql)))
+		})
+	}
+}
+
+func TestSplitStatementsPostgres(t *testing.T) {
+	sql := `CREATE FUNCTION f() RETURNS trigger AS $body$
+BEGIN
+	NEW.x := 'a;b';
+	RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+DO $$ BEGIN PERFORM 1; END $$;
+SELECT E'it\'s;', $1;
+CREATE FUNCTION g() RETURNS int BEGIN ATOMIC SELECT 1; SELECT 2; END;`
+
+	require.Equal(t, []string{
+		`CREATE FUNCTION f() RETURNS trigger AS $body$
+BEGIN
+	NEW.x := 'a;b';
+	RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;`,
+		`DO $$ BEGIN PERFORM 1; END $$;`,
+		`SELECT E'it\'s;', $1;`,
+		`CREATE FUNCTION g() RETURNS int BEGIN ATOMIC SELECT 1; SELECT 2; END;`,
+	}, statementSQL(PostgresDialect{}.splitStatements(sql)))
+}
+
+func TestSplitStatementsMySQL(t *testing.T) {
+	sql := "INSERT INTO a VALUES ('it\\'s;');\n" +
+		"# hash; comment\n" +
+		"SELECT `odd;name` FROM a;\n" +
+		"/*!40101 SET NAMES utf8 */;\n" +
+		`CREATE PROCEDURE p()
+BEGIN
+	IF 1 THEN
+		SELECT 1;
+	END IF;
+	SELECT 2;
+END;
+CREATE PROCEDURE q() BEGIN CASE x WHEN 1 THEN SELECT 1; END CASE; END;
+SELECT 2;
+BEGIN NOT ATOMIC SELECT 1; END;`
+
+	require.Equal(t, []string{
+		`INSERT INTO a VALUES ('it\'s;');`,
+		"SELECT `odd;name` FROM a;",
+		"/*!40101 SET NAMES utf8 */;",
+		`CREATE PROCEDURE p()
+BEGIN
+	IF 1 THEN
+		SELECT 1;
+	END IF;
+	SELECT 2;
+END;`,
+		"CREATE PROCEDURE q() BEGIN CASE x WHEN 1 THEN SELECT 1; END CASE; END;",
+		"SELECT 2;",
+		"BEGIN NOT ATOMIC SELECT 1; END;",
+	}, statementSQL(MySQLDialect{}.splitStatements(sql)))
+}
+
+func TestSplitStatementsLines(t *testing.T) {
+	sql := NoTransactionPrefix + "CREATE TABLE a (\n\tid int\n);\n\n\nINSERT INTO a VALUES (1); SELECT 1;\n"
+
+	require.Equal(t, []statement{
+		{SQL: "CREATE TABLE a (\n\tid int\n);", StartLine: 2, EndLine: 4},
+		{SQL: "INSERT INTO a VALUES (1);", StartLine: 7, EndLine: 7},
+		{SQL: "SELECT 1;", StartLine: 7, EndLine: 7},
+	}, sqlSplitter{}.split(sql))
+}
+
+func TestStatementKeyword(t *testing.T) {
+	require.Equal(t, "CREATE", statementKeyword("-- comment\n/* more */ create table x ();"))
+	require.Equal(t, "INSERT", statementKeyword("  Insert INTO x VALUES (1)"))
+	require.Equal(t, "", statementKeyword("(SELECT 1)"))
+	require.Equal(t, "", statementKeyword("-- only a comment"))
+}
+
+func TestIsAtomicWithoutTransactionalDDL(t *testing.T) {
+	require.True(t, isAtomicWithoutTransactionalDDL([]statement{
+		{SQL: "ALTER TABLE a ADD b int;"},
+	}))
+	require.True(t, isAtomicWithoutTransactionalDDL([]statement{
+		{SQL: "INSERT INTO a VALUES (1);"},
+		{SQL: "UPDATE a SET b = 2;"},
+	}))
+	require.False(t, isAtomicWithoutTransactionalDDL([]statement{
+		{SQL: "ALTER TABLE a ADD b int;"},
+		{SQL: "UPDATE a SET b = 2;"},
+	}))
+}
+
+func TestSplitBatches(t *testing.T) {
+	cases := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{
+			name:     "no separator",
+			sql:      "CREATE TABLE a (id int);\nINSERT INTO a VALUES (1);\n",
+			expected: []string{"CREATE TABLE a (id int);\nINSERT INTO a VALUES (1);"},
+		},
+		{
+			name: "separators",
+			sql:  "CREATE TABLE a (id int)\nGO\ngo  \r\nCREATE VIEW v AS SELECT id FROM a\n  Go\n",
+			expected: []string{
+				"CREATE TABLE a (id int)",
+				"CREATE VIEW v AS SELECT id FROM a",
+			},
+		},
+		{
+			name: "repeat count",
+			sql:  "INSERT INTO a DEFAULT VALUES\nGO 3\nSELECT 1",
+			expected: []string{
+				"INSERT INTO a DEFAULT VALUES",
+				"INSERT INTO a DEFAULT VALUES",
+				"INSERT INTO a DEFAULT VALUES",
+				"SELECT 1",
+			},
+		},
+		{
+			name: "comments",
+			sql:  "CREATE TABLE a (id int)\nGO -- create a\nINSERT INTO a DEFAULT VALUES\nGO 2 -- twice\n",
+			expected: []string{
+				"CREATE TABLE a (id int)",
+				"INSERT INTO a DEFAULT VALUES",
+				"INSERT INTO a DEFAULT VALUES",
+			},
+		},
+		{
+			name: "not separators",
+			sql:  "SELECT 'a\nGO\n' AS [x\nGO\n]\n/*\nGO\n*/\nSELECT 1 AS going\nGO x\n-- GO\n",
+			expected: []string{
+				"SELECT 'a\nGO\n' AS [x\nGO\n]\n/*\nGO\n*/\nSELECT 1 AS going\nGO x\n-- GO",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, statementSQL(splitBatches(c.sql)))
+		})
+	}
+}
+
+func TestSplitBatchesLines(t *testing.T) {
+	require.Equal(t, []statement{
+		{SQL: "CREATE TABLE a (\n\tid int\n)", StartLine: 1, EndLine: 3},
+		{SQL: "SELECT 1", StartLine: 5, EndLine: 5},
+	}, splitBatches("CREATE TABLE a (\n\tid int\n)\nGO\nSELECT 1\n"))
+}
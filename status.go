@@ -0,0 +1,84 @@
+package libmigrate
+
+import (
+	"context"
+	"sort"
+)
+
+// A MigrationStatus describes a migration known to the filesystem, the
+// database, or both.
+type MigrationStatus struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+	HasUp   bool   `json:"has_up"`
+	HasDown bool   `json:"has_down"`
+	IsGo    bool   `json:"is_go"`
+	// False for applied migrations whose files are missing
+	OnFilesystem bool `json:"on_filesystem"`
+	// The version table row, for applied migrations
+	History *AppliedMigration `json:"history,omitempty"`
+}
+
+func (m *migrator) Status(ctx context.Context) (result []MigrationStatus, err error) {
+	err = m.db.RequireSchema(ctx)
+	if err != nil {
+		return
+	}
+
+	names, err := m.filesystem.ListMigrationDir()
+	if err != nil {
+		return
+	}
+	migrationsByVersion, err := parseMigrationFilenames(names, m.goMigrations)
+	if err != nil {
+		return
+	}
+
+	dbMigrations, err := m.db.ListMigrations(ctx)
+	if err != nil {
+		return
+	}
+
+	return migrationStatus(sortMigrations(migrationsByVersion), dbMigrations), nil
+}
+
+// migrationStatus lists every migration in either list, by version. Unlike
+// listMigrations, it doesn't fail if they disagree.
+func migrationStatus(migrations []migration, dbMigrations []dbMigration) []MigrationStatus {
+	byVersion := make(map[int]*MigrationStatus, len(migrations))
+	for _, migration := range migrations {
+		byVersion[migration.Version] = &MigrationStatus{
+			Version:      migration.Version,
+			Name:         migration.Name,
+			HasUp:        migration.HasUp,
+			HasDown:      migration.HasDown,
+			IsGo:         migration.Go != nil,
+			OnFilesystem: true,
+		}
+	}
+
+	for _, dbMigration := range dbMigrations {
+		status, ok := byVersion[dbMigration.Version]
+		if !ok {
+			status = &MigrationStatus{
+				Version: dbMigration.Version,
+				Name:    dbMigration.Name,
+			}
+			byVersion[dbMigration.Version] = status
+		}
+
+		applied := dbMigration.applied()
+		status.Applied = true
+		status.History = &applied
+	}
+
+	result := make([]MigrationStatus, 0, len(byVersion))
+	for _, status := range byVersion {
+		result = append(result, *status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
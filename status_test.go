@@ -0,0 +1,65 @@
+package libmigrate
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	m, db, fs := Fixture(t)
+	fs.listMigrationDir = func() ([]string, error) {
+		return []string{
+			"0001_v1.up.sql",
+			"0001_v1.down.sql",
+			"0002_v2.up.sql",
+		}, nil
+	}
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		// Migration 3's files are gone
+		return []dbMigration{
+			{Version: 1, Name: "v1", Checksum: "abc"},
+			{Version: 3, Name: "v3"},
+		}, nil
+	}
+
+	status, err := m.Status(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []MigrationStatus{
+		{
+			Version:      1,
+			Name:         "v1",
+			Applied:      true,
+			HasUp:        true,
+			HasDown:      true,
+			OnFilesystem: true,
+			History:      &AppliedMigration{Version: 1, Name: "v1", Checksum: "abc"},
+		},
+		{
+			Version:      2,
+			Name:         "v2",
+			HasUp:        true,
+			OnFilesystem: true,
+		},
+		{
+			Version: 3,
+			Name:    "v3",
+			Applied: true,
+			History: &AppliedMigration{Version: 3, Name: "v3"},
+		},
+	}, status)
+
+	encoded, err := json.Marshal(status[1])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"version": 2,
+		"name": "v2",
+		"applied": false,
+		"has_up": true,
+		"has_down": false,
+		"is_go": false,
+		"on_filesystem": true
+	}`, string(encoded))
+}
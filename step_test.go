@@ -0,0 +1,110 @@
+package libmigrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stepFixture tracks the version as migrations are applied.
+func stepFixture(t *testing.T, version int) (*migrator, *[]int) {
+	m, db, _ := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return version, nil }
+	var applied []int
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, v int, name, query, checksum string) error {
+		if isUp {
+			applied = append(applied, v)
+			version = v
+		} else {
+			applied = append(applied, -v)
+			version = v - 1
+		}
+		return nil
+	}
+	return m, &applied
+}
+
+func TestUp(t *testing.T) {
+	m, applied := stepFixture(t, 1)
+
+	err := m.Up(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 3}, *applied)
+
+	err = m.Up(context.Background(), 1)
+	require.Equal(t, &badVersionError{version: 4, problem: "max version is 3"}, err)
+}
+
+func TestDown(t *testing.T) {
+	m, applied := stepFixture(t, 3)
+
+	err := m.Down(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, []int{-3, -2}, *applied)
+
+	err = m.Down(context.Background(), 2)
+	require.Equal(t, &badVersionError{version: -1, problem: "version must be 0 or higher"}, err)
+}
+
+func TestRedo(t *testing.T) {
+	m, applied := stepFixture(t, 2)
+
+	err := m.Redo(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int{-2, 2}, *applied)
+
+	m, _ = stepFixture(t, 0)
+	err = m.Redo(context.Background())
+	require.IsType(t, &badVersionError{}, err)
+}
+
+func TestRedoChecksBothDirections(t *testing.T) {
+	m, applied := stepFixture(t, 2)
+	m.filesystem.(*fsMock).readMigration = func(name string) (string, error) {
+		if name == "0002_v2.up.sql" {
+			return "-- migrate: typo\n", nil
+		}
+		return "", nil
+	}
+
+	err := m.Redo(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "0002_v2.up.sql")
+	require.Empty(t, *applied)
+}
+
+func TestRedoDryRun(t *testing.T) {
+	m, applied := stepFixture(t, 2)
+	m.filesystem.(*fsMock).readMigration = func(name string) (string, error) { return "", nil }
+	m.db.(*dbMock).listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{{Version: 1, Name: "v1"}, {Version: 2, Name: "v2"}}, nil
+	}
+	m.SetDryRun(true)
+	logger := &recordLogger{}
+	m.SetLogger(logger)
+
+	err := m.Redo(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, *applied)
+	var messages []string
+	for _, event := range logger.events {
+		messages = append(messages, event.Message)
+	}
+	require.Equal(t, []string{
+		"Redoing version 2",
+		"Dry run: nothing will be changed",
+		"- 0002_v2.down.sql",
+		"+ 0002_v2.up.sql",
+	}, messages[:4])
+}
+
+func TestUpDownNegative(t *testing.T) {
+	m, applied := stepFixture(t, 2)
+
+	err := m.Up(context.Background(), -1)
+	require.Equal(t, &badVersionError{version: -1, problem: "the number of migrations can't be negative"}, err)
+	err = m.Down(context.Background(), -1)
+	require.Equal(t, &badVersionError{version: -1, problem: "the number of migrations can't be negative"}, err)
+	require.Empty(t, *applied)
+}
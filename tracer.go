@@ -0,0 +1,71 @@
+package libmigrate
+
+import (
+	"context"
+)
+
+// A Tracer wraps parts of a run, e.g. in tracing spans (see the otelmigrate
+// package for OpenTelemetry). Each Start method returns the context the
+// wrapped work runs with, and a function to call with its result when it's
+// done.
+type Tracer interface {
+	// Called before the run takes the lock, so run's fields are filled in
+	// afterwards, as they're known; read them when the run ends. They're
+	// zero if the run failed first.
+	StartRun(ctx context.Context, run *RunStartedEvent) (context.Context, func(err error))
+	StartMigration(ctx context.Context, migration *MigrationStartedEvent) (context.Context, func(err error))
+	// Only called for dialects that split migrations into statements, within
+	// a migration.
+	StartStatement(ctx context.Context, statement *StatementEvent) (context.Context, func(err error))
+}
+
+// A StatementEvent describes one statement of a SQL migration.
+type StatementEvent struct {
+	// Counting from 1, out of Total
+	Statement int
+	Total     int
+	// Lines of the migration file the statement is on
+	StartLine int
+	EndLine   int
+	SQL       string
+}
+
+func (m *migrator) SetTracer(tracer Tracer) {
+	m.tracer = tracer
+	m.db.SetTracer(tracer)
+}
+
+func (db *dbWrapperImpl) SetTracer(tracer Tracer) {
+	db.tracer = tracer
+}
+
+func endNothing(err error) {}
+
+func (m *migrator) startRun(ctx context.Context, run *RunStartedEvent) (context.Context, func(err error)) {
+	if m.tracer == nil {
+		return ctx, endNothing
+	}
+
+	return m.tracer.StartRun(ctx, run)
+}
+
+func (m *migrator) startMigration(ctx context.Context, step PlanStep, transaction string) (context.Context, func(err error)) {
+	if m.tracer == nil {
+		return ctx, endNothing
+	}
+
+	return m.tracer.StartMigration(ctx, &MigrationStartedEvent{
+		Version:     step.Version,
+		Name:        step.Name,
+		IsUp:        step.IsUp,
+		Transaction: transaction,
+	})
+}
+
+func (w *dbWrapperImpl) startStatement(ctx context.Context, statement *StatementEvent) (context.Context, func(err error)) {
+	if w.tracer == nil {
+		return ctx, endNothing
+	}
+
+	return w.tracer.StartStatement(ctx, statement)
+}
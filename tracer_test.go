@@ -0,0 +1,131 @@
+package libmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type spanKey struct{}
+
+// recordTracer logs each span, and names the innermost one in its context.
+type recordTracer struct {
+	calls []string
+}
+
+func (r *recordTracer) start(ctx context.Context, name string) (context.Context, func(error)) {
+	if parent, ok := ctx.Value(spanKey{}).(string); ok {
+		name = parent + "/" + name
+	}
+	r.calls = append(r.calls, "start "+name)
+	return context.WithValue(ctx, spanKey{}, name), func(err error) {
+		r.calls = append(r.calls, fmt.Sprintf("end %s %v", name, err))
+	}
+}
+
+// The run's versions are only known by the time it ends.
+func (r *recordTracer) StartRun(ctx context.Context, run *RunStartedEvent) (context.Context, func(error)) {
+	ctx, end := r.start(ctx, "run")
+	return ctx, func(err error) {
+		r.calls = append(r.calls, fmt.Sprintf("run was %d-%d (%d)", run.FromVersion, run.ToVersion, run.Migrations))
+		end(err)
+	}
+}
+
+func (r *recordTracer) StartMigration(ctx context.Context, migration *MigrationStartedEvent) (context.Context, func(error)) {
+	return r.start(ctx, fmt.Sprintf("%d %s", migration.Version, migration.Transaction))
+}
+
+func (r *recordTracer) StartStatement(ctx context.Context, statement *StatementEvent) (context.Context, func(error)) {
+	return r.start(ctx, fmt.Sprintf("statement %d/%d", statement.Statement, statement.Total))
+}
+
+func TestTracer(t *testing.T) {
+	m, db, _ := Fixture(t)
+	db.setTracer = func(tracer Tracer) {}
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	cause := errors.New("failed")
+	var spans []interface{}
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		spans = append(spans, ctx.Value(spanKey{}))
+		if version == 2 {
+			return cause
+		}
+		return nil
+	}
+	tracer := &recordTracer{}
+	m.SetTracer(tracer)
+	db.tryLock = func(ctx context.Context) (func(context.Context) error, bool, error) {
+		tracer.calls = append(tracer.calls, fmt.Sprintf("lock in %v", ctx.Value(spanKey{})))
+		return func(context.Context) error { return nil }, true, nil
+	}
+
+	err := m.MigrateTo(context.Background(), 3)
+	require.Equal(t, cause, err)
+	require.Equal(t, []interface{}{"run/1 transaction", "run/2 transaction"}, spans)
+	require.Equal(t, []string{
+		"start run",
+		"lock in run",
+		"start run/1 transaction",
+		"end run/1 transaction <nil>",
+		"start run/2 transaction",
+		"end run/2 transaction failed",
+		"run was 0-3 (3)",
+		"end run failed",
+	}, tracer.calls)
+}
+
+func TestTracerBatch(t *testing.T) {
+	m, db, _ := Fixture(t)
+	m.SetBatchMode(BatchRequired)
+	db.setTracer = func(tracer Tracer) {}
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	db.applyBatch = func(ctx context.Context, migrations []batchMigration) error {
+		for _, migration := range migrations {
+			migrationCtx, err := migration.Before(ctx)
+			require.NoError(t, err)
+			migration.After(migrationCtx, 0, nil)
+		}
+		return nil
+	}
+	tracer := &recordTracer{}
+	m.SetTracer(tracer)
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"start run",
+		"start run/1 batch",
+		"start run/2 batch",
+		"end run/1 batch <nil>",
+		"end run/2 batch <nil>",
+		"run was 0-2 (2)",
+		"end run <nil>",
+	}, tracer.calls)
+}
+
+func TestTracerStatements(t *testing.T) {
+	f, db := newFakeDB(t)
+	cause := errors.New("syntax error")
+	f.onError(`^INSERT INTO b`, cause)
+	tracer := &recordTracer{}
+	w := &dbWrapperImpl{
+		db:        db,
+		dialect:   PostgresDialect{},
+		tableName: "migration_version",
+		tracer:    tracer,
+	}
+
+	err := w.ApplyMigration(context.Background(), true, true, 1, "first",
+		"CREATE TABLE b (id int);\nINSERT INTO b VALUES (1);\nSELECT 1;\n", "")
+	require.Error(t, err)
+	require.Equal(t, []string{
+		"start statement 1/3",
+		"end statement 1/3 <nil>",
+		"start statement 2/3",
+		"end statement 2/3 syntax error",
+	}, tracer.calls)
+}
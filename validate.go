@@ -0,0 +1,57 @@
+package libmigrate
+
+import (
+	"strings"
+)
+
+// directivePrefix starts a line that configures a migration, like
+// NoTransactionPrefix.
+const directivePrefix = "-- migrate:"
+
+// newValidationError reports problems found before running any migrations:
+// nil if there are none, the problem itself if there's one, and a
+// *validationError listing them otherwise.
+func newValidationError(problems []error) error {
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return problems[0]
+	}
+	return &validationError{problems: problems}
+}
+
+// validateStep checks a planned step for problems that would stop it from
+// running.
+func (m *migrator) validateStep(step PlanStep) (problems []error) {
+	if !step.IsGo {
+		if line, ok := badDirective(step.SQL); ok {
+			problems = append(problems, &badDirectiveError{
+				filename:  step.Filename,
+				directive: line,
+			})
+		}
+	}
+
+	if m.requireAtomic && !m.isAtomic(step) {
+		problems = append(problems, nonAtomicError(step))
+	}
+	return
+}
+
+// badDirective finds a first line that looks like a directive, but isn't
+// one libmigrate understands (e.g. a typo, or a Windows line ending).
+func badDirective(sql string) (line string, ok bool) {
+	if strings.HasPrefix(sql, NoTransactionPrefix) {
+		return "", false
+	}
+
+	line = sql
+	if end := strings.IndexByte(sql, '\n'); end >= 0 {
+		line = sql[:end]
+	}
+	if !strings.HasPrefix(strings.TrimSpace(line), directivePrefix) {
+		return "", false
+	}
+	return line, true
+}
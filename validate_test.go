@@ -0,0 +1,75 @@
+package libmigrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateToReportsEveryProblem(t *testing.T) {
+	m, db, fs := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return 0, nil }
+	db.applyMigration = func(ctx context.Context, useTx, isUp bool, version int, name, query, checksum string) error {
+		t.Fatal("applied a migration despite problems")
+		return nil
+	}
+	readErr := errors.New("permission denied")
+	fs.readMigration = func(name string) (string, error) {
+		switch name {
+		case "0002_v2.up.sql":
+			return "", readErr
+		case "0003_v3.up.sql":
+			return "-- migrate: no-transaction\r\nCREATE INDEX", nil
+		}
+		return "", nil
+	}
+
+	err := m.MigrateTo(context.Background(), 3)
+	require.Equal(t, &validationError{problems: []error{
+		readErr,
+		&badDirectiveError{
+			filename:  "0003_v3.up.sql",
+			directive: "-- migrate: no-transaction\r",
+		},
+	}}, err)
+	require.Equal(t, `Found 2 problems before migrating:
+ - permission denied
+ - Migration 0003_v3.up.sql starts with unknown directive "-- migrate: no-transaction\r" (expected "-- migrate: no-transaction")`, err.Error())
+}
+
+func TestMigrateToReportsChecksumsWithPathProblems(t *testing.T) {
+	m, db, fs := Fixture(t)
+	db.getVersion = func(ctx context.Context) (int, error) { return 1, nil }
+	db.listMigrations = func(ctx context.Context) ([]dbMigration, error) {
+		return []dbMigration{{Version: 1, Name: "v1", Checksum: "stale"}}, nil
+	}
+	fs.readMigration = func(name string) (string, error) {
+		if name == "0002_v2.up.sql" {
+			return "-- migrate: typo\n", nil
+		}
+		return "", nil
+	}
+
+	err := m.MigrateTo(context.Background(), 2)
+	require.IsType(t, &validationError{}, err)
+	problems := err.(*validationError).Problems()
+	require.Len(t, problems, 2)
+	require.IsType(t, &ChecksumMismatchError{}, problems[0])
+	require.IsType(t, &badDirectiveError{}, problems[1])
+}
+
+func TestBadDirective(t *testing.T) {
+	cases := map[string]bool{
+		NoTransactionPrefix + "SELECT 1":        false,
+		"-- a comment\nSELECT 1":                false,
+		"SELECT 1":                              false,
+		"-- migrate: no-transactions\nSELECT 1": true,
+		"  -- migrate:no-transaction":           true,
+	}
+	for sql, expected := range cases {
+		_, ok := badDirective(sql)
+		require.Equal(t, expected, ok, sql)
+	}
+}